@@ -14,7 +14,9 @@ import (
 	"github.com/blockdaemon/s3-bucket-browser/internal/api"
 	"github.com/blockdaemon/s3-bucket-browser/internal/cache"
 	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/index"
 	"github.com/blockdaemon/s3-bucket-browser/internal/s3"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
 	"github.com/gorilla/mux"
 )
 
@@ -29,10 +31,19 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Create S3 service
-	s3Service, err := s3.NewService(&cfg.S3)
-	if err != nil {
-		log.Fatalf("Failed to create S3 service: %v", err)
+	// Commands run against the sources and exit instead of serving them
+	if flag.Arg(0) == "pairing" {
+		os.Exit(runPairing(cfg, flag.Args()[1:]))
+	}
+
+	// Create an object store per source
+	sources := make([]*api.Source, 0, len(cfg.Sources))
+	for _, sourceCfg := range cfg.Sources {
+		store, err := newObjectStore(sourceCfg)
+		if err != nil {
+			log.Fatalf("Failed to create %s object store for source %s: %v", sourceCfg.Backend, sourceCfg.Name, err)
+		}
+		sources = append(sources, api.NewSource(sourceCfg.Name, sourceCfg.Backend, storage.WithPrefix(store, sourceCfg.Prefix)))
 	}
 
 	// Create Redis cache (optional)
@@ -46,8 +57,19 @@ func main() {
 		defer cacheService.Close()
 	}
 
+	// Open the on-disk metadata index (optional)
+	var catalogIndex *index.DB
+	if cfg.Index.Path != "" {
+		catalogIndex, err = index.Open(cfg.Index.Path)
+		if err != nil {
+			log.Fatalf("Failed to open metadata index: %v", err)
+		}
+		defer catalogIndex.Close()
+		log.Printf("Using metadata index %s", cfg.Index.Path)
+	}
+
 	// Create API handler
-	handler := api.NewHandler(s3Service, cacheService)
+	handler := api.NewHandler(sources, cacheService, catalogIndex, cfg)
 
 	// Create router
 	router := mux.NewRouter()
@@ -91,3 +113,28 @@ func main() {
 
 	log.Println("Server exited properly")
 }
+
+// newObjectStore creates the object store selected by a source configuration
+func newObjectStore(cfg config.SourceConfig) (storage.ObjectStore, error) {
+	switch cfg.Backend {
+	case config.BackendFileSystem:
+		log.Printf("Source %s: serving objects from directory %s", cfg.Name, cfg.Root)
+		return storage.NewFileSystemStore(cfg.Root)
+	case config.BackendMemory:
+		store := storage.NewMemoryStore()
+		if cfg.Root != "" {
+			seed, err := storage.NewFileSystemStore(cfg.Root)
+			if err != nil {
+				return nil, err
+			}
+			if err := storage.CopyObjects(context.Background(), store, seed, ""); err != nil {
+				return nil, err
+			}
+			log.Printf("Source %s: seeded memory store from directory %s", cfg.Name, cfg.Root)
+		}
+		return store, nil
+	default:
+		log.Printf("Source %s: serving objects from bucket %s", cfg.Name, cfg.Bucket)
+		return s3.NewService(&cfg.S3Config)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/api"
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+// runPairing runs the pairing command, which reports the archives without
+// metadata files, the metadata files without archives and the pairs whose
+// sizes disagree in every source, or in the one named by -source. It returns
+// the exit code: 1 if anything is unpaired or mismatched, 2 on errors.
+func runPairing(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("pairing", flag.ExitOnError)
+	sourceName := flags.String("source", "", "Only check the named source")
+	asJSON := flags.Bool("json", false, "Print the reports as JSON")
+	flags.Parse(args)
+
+	reports := make(map[string]api.PairingReport)
+	var names []string
+	for _, sourceCfg := range cfg.Sources {
+		if *sourceName != "" && sourceCfg.Name != *sourceName {
+			continue
+		}
+
+		store, err := newObjectStore(sourceCfg)
+		if err != nil {
+			log.Printf("Failed to create %s object store for source %s: %v", sourceCfg.Backend, sourceCfg.Name, err)
+			return 2
+		}
+		report, err := api.CheckPairing(context.Background(), storage.WithPrefix(store, sourceCfg.Prefix), cfg)
+		if err != nil {
+			log.Printf("Failed to check source %s: %v", sourceCfg.Name, err)
+			return 2
+		}
+		reports[sourceCfg.Name] = report
+		names = append(names, sourceCfg.Name)
+	}
+
+	if len(names) == 0 {
+		log.Printf("Unknown source %q", *sourceName)
+		return 2
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reports); err != nil {
+			log.Printf("Failed to write the reports: %v", err)
+			return 2
+		}
+	} else {
+		for _, name := range names {
+			printPairingReport(os.Stdout, name, reports[name])
+		}
+	}
+
+	for _, report := range reports {
+		if !report.Clean() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// printPairingReport writes a report as text
+func printPairingReport(out io.Writer, name string, report api.PairingReport) {
+	fmt.Fprintf(out, "Source %s: %d archives, %d paired, %d orphaned bytes\n",
+		name, report.Archives, report.Pairs, report.OrphanBytes)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if len(report.ArchivesWithoutMetadata) > 0 {
+		fmt.Fprintf(w, "\nArchives without metadata (%d, %d bytes):\n", len(report.ArchivesWithoutMetadata), report.OrphanArchiveBytes)
+		for _, orphan := range report.ArchivesWithoutMetadata {
+			fmt.Fprintf(w, "  %s\t%d\tmissing %s\n", orphan.Key, orphan.Size, orphan.MetadataKey)
+		}
+	}
+	if len(report.MetadataWithoutArchives) > 0 {
+		fmt.Fprintf(w, "\nMetadata without archives (%d, %d bytes):\n", len(report.MetadataWithoutArchives), report.OrphanMetadataBytes)
+		for _, orphan := range report.MetadataWithoutArchives {
+			fmt.Fprintf(w, "  %s\t%d\n", orphan.Key, orphan.Size)
+		}
+	}
+	if len(report.SizeMismatches) > 0 {
+		fmt.Fprintf(w, "\nSize mismatches (%d):\n", len(report.SizeMismatches))
+		for _, mismatch := range report.SizeMismatches {
+			fmt.Fprintf(w, "  %s\t%d\tdeclared %d by %s\n", mismatch.Archive, mismatch.ArchiveSize, mismatch.MetadataSize, mismatch.Metadata)
+		}
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+}
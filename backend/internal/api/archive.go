@@ -0,0 +1,340 @@
+package api
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+const (
+	defaultArchiveEntries = 1000
+	maxArchiveEntries     = 100000
+	// manifestExpiration is how long manifests are cached in Redis. A
+	// manifest never goes stale since it is keyed by the object's ETag.
+	manifestExpiration = 24 * time.Hour
+	// maxCachedManifests caps the manifests cached in memory per source
+	maxCachedManifests = 100
+	// snapshotVersionLimit caps the bytes read from a snapshot's version file
+	snapshotVersionLimit = 64
+)
+
+// errUnsupportedCompression is returned for archives that cannot be
+// decompressed
+var errUnsupportedCompression = errors.New("unsupported compression")
+
+// decompressors open the decompressed stream of an archive by its extension
+var decompressors = map[string]func(io.Reader) (io.ReadCloser, error){
+	".tar": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(r), nil
+	},
+	".tar.gz": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	".tar.bz2": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	},
+	".tar.zst": func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	},
+	".tar.lz4": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(lz4.NewReader(r)), nil
+	},
+}
+
+// snapshotSlotRegex matches the directory of a Solana snapshot's bank
+var snapshotSlotRegex = regexp.MustCompile(`^(?:\./)?snapshots/(\d+)(?:/|$)`)
+
+// ArchiveManifest lists the entries of a tar archive
+type ArchiveManifest struct {
+	Key         string         `json:"key"`
+	ETag        string         `json:"etag"`
+	Compression string         `json:"compression"`
+	Entries     []ArchiveEntry `json:"entries"`
+	// Truncated is set if the archive has more than Limit entries
+	Truncated bool `json:"truncated"`
+	Limit     int  `json:"limit"`
+	// Snapshot is set for Solana snapshot archives
+	Snapshot *SnapshotContents `json:"snapshot,omitempty"`
+}
+
+// ArchiveEntry is a file, directory or link in a tar archive
+type ArchiveEntry struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// SnapshotContents is what a Solana snapshot archive says about itself. Its
+// slot is cross-checked against the catalog entry.
+type SnapshotContents struct {
+	// Version is the content of the version file. It is the snapshot format
+	// version, which no metadata field records, so it is not cross-checked.
+	Version string `json:"version,omitempty"`
+	// Slot is the name of the bank directory under snapshots/
+	Slot int64 `json:"slot,omitempty"`
+	// MetadataSlot is the slot of the catalog entry
+	MetadataSlot int64 `json:"metadata_slot,omitempty"`
+	// Mismatches lists the fields that disagree with the catalog entry
+	Mismatches []string `json:"mismatches"`
+}
+
+// entryType names the type of a tar entry
+func entryType(header *tar.Header) string {
+	switch header.Typeflag {
+	case tar.TypeReg:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	}
+	return "other"
+}
+
+// readManifest lists up to limit entries of a tar archive, stopping as soon
+// as the limit is exceeded. Solana snapshot contents are collected from the
+// entries read.
+func readManifest(r io.Reader, extension string, limit int) (ArchiveManifest, error) {
+	manifest := ArchiveManifest{Compression: strings.TrimPrefix(strings.TrimPrefix(extension, ".tar"), "."), Entries: []ArchiveEntry{}, Limit: limit}
+	if manifest.Compression == "" {
+		manifest.Compression = "none"
+	}
+
+	decompress, ok := decompressors[extension]
+	if !ok {
+		return manifest, fmt.Errorf("%w: %s", errUnsupportedCompression, extension)
+	}
+	stream, err := decompress(r)
+	if err != nil {
+		return manifest, err
+	}
+	defer stream.Close()
+
+	var snapshot SnapshotContents
+	reader := tar.NewReader(stream)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, err
+		}
+
+		if len(manifest.Entries) == limit {
+			manifest.Truncated = true
+			break
+		}
+		manifest.Entries = append(manifest.Entries, ArchiveEntry{
+			Name:    header.Name,
+			Type:    entryType(header),
+			Size:    header.Size,
+			Mode:    header.FileInfo().Mode().String(),
+			ModTime: header.ModTime.UTC(),
+		})
+
+		name := strings.TrimPrefix(header.Name, "./")
+		if name == "version" && header.Typeflag == tar.TypeReg {
+			version, err := io.ReadAll(io.LimitReader(reader, snapshotVersionLimit))
+			if err != nil {
+				return manifest, err
+			}
+			snapshot.Version = strings.TrimSpace(string(version))
+		}
+		if match := snapshotSlotRegex.FindStringSubmatch(name); match != nil && snapshot.Slot == 0 {
+			snapshot.Slot, _ = strconv.ParseInt(match[1], 10, 64)
+		}
+	}
+
+	if snapshot.Version != "" || snapshot.Slot != 0 {
+		manifest.Snapshot = &snapshot
+	}
+	return manifest, nil
+}
+
+// crossCheck compares a snapshot's slot with the slot of its catalog entry
+func (c *SnapshotContents) crossCheck(metadataSlot int64) {
+	c.MetadataSlot = metadataSlot
+	c.Mismatches = []string{}
+	if c.Slot != 0 && metadataSlot != 0 && c.Slot != metadataSlot {
+		c.Mismatches = append(c.Mismatches, "slot")
+	}
+}
+
+// manifestCache holds the manifests of a source in memory, keyed by object
+// key and ETag
+type manifestCache struct {
+	manifests map[string]ArchiveManifest
+	mutex     sync.Mutex
+}
+
+// get returns a cached manifest that lists at least limit entries, or all
+func (c *manifestCache) get(key string, limit int) (ArchiveManifest, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	manifest, ok := c.manifests[key]
+	return manifest, ok && manifest.covers(limit)
+}
+
+// put caches a manifest, evicting an arbitrary one if the cache is full
+func (c *manifestCache) put(key string, manifest ArchiveManifest) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.manifests == nil {
+		c.manifests = make(map[string]ArchiveManifest)
+	}
+	if _, ok := c.manifests[key]; !ok && len(c.manifests) >= maxCachedManifests {
+		for evicted := range c.manifests {
+			delete(c.manifests, evicted)
+			break
+		}
+	}
+	c.manifests[key] = manifest
+}
+
+// covers reports whether a manifest can answer a request for limit entries
+func (m ArchiveManifest) covers(limit int) bool {
+	return !m.Truncated || m.Limit >= limit
+}
+
+// withLimit returns the manifest cut to limit entries
+func (m ArchiveManifest) withLimit(limit int) ArchiveManifest {
+	if len(m.Entries) > limit {
+		m.Entries = m.Entries[:limit]
+		m.Truncated = true
+	}
+	m.Limit = limit
+	return m
+}
+
+// archiveManifest returns the manifest of an archive from the caches, or
+// reads it from the store and caches it
+func (h *Handler) archiveManifest(ctx context.Context, source *Source, obj storage.Object, limit int) (ArchiveManifest, error) {
+	cacheKey := "archive:manifest:" + source.Name + ":" + obj.Key + ":" + obj.ETag
+
+	if manifest, ok := source.manifests.get(cacheKey, limit); ok {
+		return manifest.withLimit(limit), nil
+	}
+	if h.cacheService != nil {
+		var manifest ArchiveManifest
+		if err := h.cacheService.Get(ctx, cacheKey, &manifest); err == nil && manifest.covers(limit) {
+			source.manifests.put(cacheKey, manifest)
+			return manifest.withLimit(limit), nil
+		}
+	}
+
+	result, err := source.store.GetObject(ctx, obj.Key)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	defer result.Body.Close()
+
+	manifest, err := readManifest(result.Body, storage.ArchiveExtension(obj.Key), limit)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Key = obj.Key
+	manifest.ETag = obj.ETag
+	if manifest.Snapshot != nil {
+		metadata, _ := h.lookupMetadata(source, obj.Key)
+		manifest.Snapshot.crossCheck(metadata.Slot)
+	}
+
+	source.manifests.put(cacheKey, manifest)
+	if h.cacheService != nil {
+		if err := h.cacheService.Set(ctx, cacheKey, manifest, manifestExpiration); err != nil {
+			log.Printf("Failed to cache manifest of %s: %v", obj.Key, err)
+		}
+	}
+	return manifest, nil
+}
+
+// ListArchiveEntries lists the entries of a tar archive by streaming it
+// through its decompressor, without it being downloaded. The limit parameter
+// caps the entries listed; reading stops as soon as it is reached. Reading
+// can take longer than the server's write timeout, which does not apply.
+func (h *Handler) ListArchiveEntries(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	if !storage.IsArchiveFile(key) {
+		respondWithError(w, http.StatusBadRequest, "Not a tar archive: "+key)
+		return
+	}
+
+	limit := defaultArchiveEntries
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxArchiveEntries {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxArchiveEntries))
+			return
+		}
+		limit = n
+	}
+
+	obj, err := lookupObject(r.Context(), source, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Object not found")
+		return
+	}
+	if err != nil {
+		log.Printf("ListArchiveEntries: Failed to look up %s: %v", key, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to look up object")
+		return
+	}
+
+	log.Printf("ListArchiveEntries: Listing up to %d entries of %s in source %s", limit, key, source.Name)
+
+	// Entries far apart in a compressed archive take long to reach
+	clearWriteDeadline(w)
+
+	manifest, err := h.archiveManifest(r.Context(), source, obj, limit)
+	switch {
+	case errors.Is(err, errUnsupportedCompression):
+		respondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		respondWithError(w, http.StatusNotFound, "Object not found")
+		return
+	case err != nil:
+		log.Printf("ListArchiveEntries: Failed to read %s: %v", key, err)
+		respondWithError(w, http.StatusUnprocessableEntity, "Failed to read archive: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, manifest)
+}
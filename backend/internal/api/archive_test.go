@@ -0,0 +1,220 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// buildTar writes a tar archive of the given files, directories ending in /
+func buildTar(t *testing.T, files map[string]string, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), ModTime: time.Unix(0, 0), Typeflag: tar.TypeReg}
+		if name[len(name)-1] == '/' {
+			header = &tar.Header{Name: name, Mode: 0755, ModTime: time.Unix(0, 0), Typeflag: tar.TypeDir}
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("WriteHeader(%q) error = %v", name, err)
+		}
+		if _, err := io.WriteString(writer, files[name]); err != nil {
+			t.Fatalf("Write(%q) error = %v", name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd.NewWriter() error = %v", err)
+	}
+	return encoder.EncodeAll(data, nil)
+}
+
+func lz4Bytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := lz4.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("lz4 Write() error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("lz4 Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadManifest(t *testing.T) {
+	files := map[string]string{"version": "1.2.0\n", "snapshots/150/150": "bank"}
+	archive := buildTar(t, files, "version", "snapshots/", "snapshots/150/", "snapshots/150/150", "accounts/")
+
+	tests := []struct {
+		name          string
+		data          []byte
+		extension     string
+		limit         int
+		wantEntries   int
+		wantTruncated bool
+		wantSnapshot  *SnapshotContents
+		wantErr       error
+	}{
+		{name: "tar", data: archive, extension: ".tar", limit: 10, wantEntries: 5, wantSnapshot: &SnapshotContents{Version: "1.2.0", Slot: 150}},
+		{name: "gzip", data: gzipBytes(t, archive), extension: ".tar.gz", limit: 10, wantEntries: 5, wantSnapshot: &SnapshotContents{Version: "1.2.0", Slot: 150}},
+		{name: "zstd", data: zstdBytes(t, archive), extension: ".tar.zst", limit: 10, wantEntries: 5, wantSnapshot: &SnapshotContents{Version: "1.2.0", Slot: 150}},
+		{name: "limit", data: archive, extension: ".tar", limit: 1, wantEntries: 1, wantTruncated: true, wantSnapshot: &SnapshotContents{Version: "1.2.0"}},
+		{name: "exact limit", data: archive, extension: ".tar", limit: 5, wantEntries: 5, wantSnapshot: &SnapshotContents{Version: "1.2.0", Slot: 150}},
+		{name: "not a snapshot", data: buildTar(t, nil, "data/"), extension: ".tar", limit: 10, wantEntries: 1},
+		{name: "lz4", data: lz4Bytes(t, archive), extension: ".tar.lz4", limit: 10, wantEntries: 5, wantSnapshot: &SnapshotContents{Version: "1.2.0", Slot: 150}},
+		{name: "unsupported", data: archive, extension: ".tar.xz", limit: 10, wantErr: errUnsupportedCompression},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := readManifest(bytes.NewReader(tt.data), tt.extension, tt.limit)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("readManifest() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readManifest() error = %v", err)
+			}
+			if len(manifest.Entries) != tt.wantEntries || manifest.Truncated != tt.wantTruncated {
+				t.Errorf("readManifest() = %d entries, truncated %v, want %d, %v", len(manifest.Entries), manifest.Truncated, tt.wantEntries, tt.wantTruncated)
+			}
+			if (manifest.Snapshot == nil) != (tt.wantSnapshot == nil) ||
+				(tt.wantSnapshot != nil && (manifest.Snapshot.Version != tt.wantSnapshot.Version || manifest.Snapshot.Slot != tt.wantSnapshot.Slot)) {
+				t.Errorf("readManifest() snapshot = %+v, want %+v", manifest.Snapshot, tt.wantSnapshot)
+			}
+		})
+	}
+
+	if _, err := readManifest(bytes.NewReader([]byte("not gzip")), ".tar.gz", 10); err == nil {
+		t.Error("readManifest() of a corrupt archive error = nil")
+	}
+}
+
+func TestListArchiveEntries(t *testing.T) {
+	files := map[string]string{"version": "1.2.0", "snapshots/150/150": "bank"}
+	archive := buildTar(t, files, "version", "snapshots/", "snapshots/150/", "snapshots/150/150")
+
+	mismatched := "snapshot-100-" + testNode
+	store := storage.NewMemoryStore()
+	putObject(t, store, mismatched+".json", `{"slot":100}`)
+	putObject(t, store, mismatched+".tar.gz", string(gzipBytes(t, archive)))
+	putObject(t, store, "corrupt.tar.gz", "not gzip")
+	putObject(t, store, "corrupt.tar.lz4", "not lz4")
+	putObject(t, store, "notes.txt", "notes")
+
+	source := NewSource("mainnet", config.BackendMemory, store)
+	if _, err := source.catalog.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		path          string
+		wantCode      int
+		wantEntries   int
+		wantTruncated bool
+	}{
+		{path: "/api/archive/" + mismatched + ".tar.gz/entries", wantCode: http.StatusOK, wantEntries: 4},
+		{path: "/api/archive/" + mismatched + ".tar.gz/entries?limit=2", wantCode: http.StatusOK, wantEntries: 2, wantTruncated: true},
+		{path: "/api/archive/" + mismatched + ".tar.gz/entries?limit=0", wantCode: http.StatusBadRequest},
+		{path: "/api/archive/corrupt.tar.gz/entries", wantCode: http.StatusUnprocessableEntity},
+		{path: "/api/archive/corrupt.tar.lz4/entries", wantCode: http.StatusUnprocessableEntity},
+		{path: "/api/archive/notes.txt/entries", wantCode: http.StatusBadRequest},
+		{path: "/api/archive/missing.tar/entries", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var manifest ArchiveManifest
+			if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if len(manifest.Entries) != tt.wantEntries || manifest.Truncated != tt.wantTruncated {
+				t.Errorf("manifest = %d entries, truncated %v, want %d, %v", len(manifest.Entries), manifest.Truncated, tt.wantEntries, tt.wantTruncated)
+			}
+			snapshot := manifest.Snapshot
+			if snapshot == nil || snapshot.Slot != 150 || snapshot.MetadataSlot != 100 || len(snapshot.Mismatches) != 1 || snapshot.Mismatches[0] != "slot" {
+				t.Errorf("snapshot = %+v, want slot 150 mismatching metadata slot 100", snapshot)
+			}
+		})
+	}
+
+	// The manifest is cached by ETag, so it is served without the object
+	if err := store.DeleteObject(context.Background(), mismatched+".tar.gz"); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/archive/"+mismatched+".tar.gz/entries?limit=3", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("cached status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestListArchiveEntriesBeforeSync(t *testing.T) {
+	key := "snapshot-100-" + testNode + ".tar"
+	store := storage.NewMemoryStore()
+	putObject(t, store, key, string(buildTar(t, nil, "snapshots/")))
+
+	// The catalog has not listed the store yet, so the archive is looked up
+	source := NewSource("mainnet", config.BackendMemory, store)
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	for path, wantCode := range map[string]int{
+		"/api/archive/" + key + "/entries": http.StatusOK,
+		"/api/archive/missing.tar/entries": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != wantCode {
+			t.Errorf("GET %s code = %d, want %d: %s", path, rec.Code, wantCode, rec.Body.String())
+		}
+	}
+}
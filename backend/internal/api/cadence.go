@@ -0,0 +1,285 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+// defaultCadenceGaps is the number of largest gaps reported per node
+const defaultCadenceGaps = 5
+
+// CadenceReport describes how regularly every node produces snapshots
+type CadenceReport struct {
+	GeneratedAt       time.Time     `json:"generated_at"`
+	StaleSlots        int64         `json:"stale_slots"`
+	StaleAfterSeconds int64         `json:"stale_after_seconds"`
+	Nodes             []NodeCadence `json:"nodes"`
+	// Skipped is the number of snapshots left out because their producer is
+	// unknown
+	Skipped int `json:"skipped"`
+}
+
+// NodeCadence describes the snapshots of one type produced by one node
+type NodeCadence struct {
+	Node         string `json:"node"`
+	SnapshotType string `json:"snapshot_type"`
+	Count        int    `json:"count"`
+	FirstSlot    int64  `json:"first_slot"`
+	LatestSlot   int64  `json:"latest_slot"`
+	// LatestTime is when the latest snapshot was taken, if known
+	LatestTime *time.Time `json:"latest_time,omitempty"`
+	// Interval is the median number of slots between snapshots
+	Interval int64 `json:"interval"`
+	// Missed is the number of snapshots missing from all gaps
+	Missed int `json:"missed"`
+	// Gaps are the largest gaps, largest first
+	Gaps []SlotGap `json:"gaps"`
+	// SlotLag is how far the latest snapshot is behind the newest snapshot
+	// of the same type of any node
+	SlotLag int64 `json:"slot_lag"`
+	Stale   bool  `json:"stale"`
+}
+
+// SlotGap is a gap between two consecutive snapshots of a node that is
+// noticeably longer than its usual interval
+type SlotGap struct {
+	FromSlot int64 `json:"from_slot"`
+	ToSlot   int64 `json:"to_slot"`
+	Slots    int64 `json:"slots"`
+	Missed   int   `json:"missed"`
+}
+
+// cadenceThresholds decide which nodes are stale and how many gaps are listed
+type cadenceThresholds struct {
+	staleSlots int64
+	staleAfter time.Duration
+	gaps       int
+}
+
+// parseCadenceThresholds parses the stale_slots, stale_after and gaps
+// parameters, which override the configured thresholds
+func (h *Handler) parseCadenceThresholds(r *http.Request) (cadenceThresholds, error) {
+	query := r.URL.Query()
+	thresholds := cadenceThresholds{
+		staleSlots: h.staleSlots,
+		staleAfter: h.staleAfter,
+		gaps:       defaultCadenceGaps,
+	}
+
+	if value := query.Get("stale_slots"); value != "" {
+		slots, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || slots < 0 {
+			return thresholds, fmt.Errorf("invalid stale_slots %q", value)
+		}
+		thresholds.staleSlots = slots
+	}
+
+	if value := query.Get("stale_after"); value != "" {
+		staleAfter, err := parseDuration(value)
+		if err != nil || staleAfter < 0 {
+			return thresholds, fmt.Errorf("invalid stale_after %q", value)
+		}
+		thresholds.staleAfter = staleAfter
+	}
+
+	if value := query.Get("gaps"); value != "" {
+		gaps, err := strconv.Atoi(value)
+		if err != nil || gaps < 0 {
+			return thresholds, fmt.Errorf("invalid gaps %q", value)
+		}
+		thresholds.gaps = gaps
+	}
+
+	return thresholds, nil
+}
+
+// analyzeCadence groups snapshots by producer and snapshot type and reports
+// the interval, gaps and staleness of each group. Entries without a slot are
+// ignored; snapshots whose producer is unknown are skipped and counted. times
+// holds the time each entry was stored, for entries whose metadata has no
+// timestamp.
+func analyzeCadence(metadataList []models.Metadata, times map[string]time.Time, thresholds cadenceThresholds, now time.Time) (nodes []NodeCadence, skipped int) {
+	type group struct{ node, snapshotType string }
+	slots := make(map[group][]int64)
+	latest := make(map[group]models.Metadata)
+	newest := make(map[string]int64)
+
+	for _, metadata := range metadataList {
+		if metadata.Slot == 0 {
+			continue
+		}
+		node := metadata.Producer()
+		if node == "" {
+			skipped++
+			continue
+		}
+		g := group{node: node, snapshotType: metadata.SnapshotType}
+		slots[g] = append(slots[g], metadata.Slot)
+		if metadata.Slot >= latest[g].Slot {
+			latest[g] = metadata
+		}
+		newest[g.snapshotType] = max(newest[g.snapshotType], metadata.Slot)
+	}
+
+	nodes = make([]NodeCadence, 0, len(slots))
+	for g, groupSlots := range slots {
+		sort.Slice(groupSlots, func(i, j int) bool { return groupSlots[i] < groupSlots[j] })
+
+		cadence := NodeCadence{
+			Node:         g.node,
+			SnapshotType: g.snapshotType,
+			Count:        len(groupSlots),
+			FirstSlot:    groupSlots[0],
+			LatestSlot:   groupSlots[len(groupSlots)-1],
+			Gaps:         []SlotGap{},
+		}
+		cadence.SlotLag = newest[g.snapshotType] - cadence.LatestSlot
+
+		cadence.Interval = medianInterval(groupSlots)
+		for _, gap := range findGaps(groupSlots, cadence.Interval) {
+			cadence.Missed += gap.Missed
+			cadence.Gaps = append(cadence.Gaps, gap)
+		}
+		sort.SliceStable(cadence.Gaps, func(i, j int) bool { return cadence.Gaps[i].Slots > cadence.Gaps[j].Slots })
+		if len(cadence.Gaps) > thresholds.gaps {
+			cadence.Gaps = cadence.Gaps[:thresholds.gaps]
+		}
+
+		if t := metadataTime(latest[g], times); !t.IsZero() {
+			cadence.LatestTime = &t
+			if thresholds.staleAfter > 0 && now.Sub(t) > thresholds.staleAfter {
+				cadence.Stale = true
+			}
+		}
+		if thresholds.staleSlots > 0 && cadence.SlotLag > thresholds.staleSlots {
+			cadence.Stale = true
+		}
+
+		nodes = append(nodes, cadence)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Node != nodes[j].Node {
+			return nodes[i].Node < nodes[j].Node
+		}
+		return nodes[i].SnapshotType < nodes[j].SnapshotType
+	})
+	return nodes, skipped
+}
+
+// medianInterval returns the median distance between distinct sorted slots,
+// or 0 if there are fewer than two
+func medianInterval(slots []int64) int64 {
+	var intervals []int64
+	for i := 1; i < len(slots); i++ {
+		if interval := slots[i] - slots[i-1]; interval > 0 {
+			intervals = append(intervals, interval)
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	middle := len(intervals) / 2
+	if len(intervals)%2 == 0 {
+		return (intervals[middle-1] + intervals[middle]) / 2
+	}
+	return intervals[middle]
+}
+
+// findGaps returns the distances between sorted slots that are more than
+// one and a half times the interval, with the number of snapshots the
+// interval says are missing from each
+func findGaps(slots []int64, interval int64) []SlotGap {
+	if interval <= 0 {
+		return nil
+	}
+
+	var gaps []SlotGap
+	for i := 1; i < len(slots); i++ {
+		distance := slots[i] - slots[i-1]
+		if distance*2 <= interval*3 {
+			continue
+		}
+		gaps = append(gaps, SlotGap{
+			FromSlot: slots[i-1],
+			ToSlot:   slots[i],
+			Slots:    distance,
+			// Rounded to the nearest number of intervals, less the snapshot
+			// that ends the gap
+			Missed: int((distance+interval/2)/interval) - 1,
+		})
+	}
+	return gaps
+}
+
+// metadataTime returns when a snapshot was taken: the timestamp from its
+// metadata if it has one, and the time its file was stored otherwise
+func metadataTime(metadata models.Metadata, times map[string]time.Time) time.Time {
+	switch {
+	case !metadata.Timestamp.IsZero():
+		return metadata.Timestamp
+	case !metadata.UploadedAt.IsZero():
+		return metadata.UploadedAt
+	default:
+		return times[metadata.FileName]
+	}
+}
+
+// objectTimes maps the keys of a listing to their modification times
+func objectTimes(objects []storage.Object) map[string]time.Time {
+	times := make(map[string]time.Time, len(objects))
+	for _, obj := range objects {
+		times[obj.Key] = obj.LastModified
+	}
+	return times
+}
+
+// GetCadence reports, per node, how regularly snapshots are produced, the
+// largest gaps between them and whether the node has stopped producing them.
+// A node is the producer of a snapshot, as for the node constraint of
+// LatestSnapshot. The metadata filters select the entries that are analyzed.
+func (h *Handler) GetCadence(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	thresholds, err := h.parseCadenceThresholds(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	metadataList, err := filterMetadata(r, source)
+	if err != nil {
+		log.Printf("GetCadence: Invalid query: %v", err)
+		respondWithQueryError(w, err)
+		return
+	}
+
+	now := time.Now()
+	report := CadenceReport{
+		GeneratedAt:       now,
+		StaleSlots:        thresholds.staleSlots,
+		StaleAfterSeconds: int64(thresholds.staleAfter / time.Second),
+	}
+	report.Nodes, report.Skipped = analyzeCadence(metadataList, objectTimes(source.catalog.Objects()), thresholds, now)
+
+	log.Printf("GetCadence: Analyzed %d entries of %d nodes in source %s, skipped %d without a producer", len(metadataList), len(report.Nodes), source.Name, report.Skipped)
+
+	respondWithJSON(w, http.StatusOK, report)
+}
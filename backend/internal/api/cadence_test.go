@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+func TestMedianInterval(t *testing.T) {
+	tests := []struct {
+		slots []int64
+		want  int64
+	}{
+		{slots: []int64{100}, want: 0},
+		{slots: []int64{100, 200, 300, 700}, want: 100},
+		{slots: []int64{100, 200, 200, 400}, want: 150},
+		{slots: []int64{0, 10, 30, 60}, want: 20},
+	}
+	for _, tt := range tests {
+		if got := medianInterval(tt.slots); got != tt.want {
+			t.Errorf("medianInterval(%v) = %d, want %d", tt.slots, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeCadence(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(node, snapshotType string, slot int64) models.Metadata {
+		return models.Metadata{
+			FileName:     fmt.Sprintf("%s-%s-%d.json", node, snapshotType, slot),
+			UploadedBy:   node,
+			SnapshotType: snapshotType,
+			Slot:         slot,
+		}
+	}
+
+	var metadataList []models.Metadata
+	for _, slot := range []int64{1000, 2000, 3000, 6000, 7000, 9000} {
+		metadataList = append(metadataList, entry("a", models.SnapshotTypeFull, slot))
+	}
+	// Node b has a recent timestamp but fell far behind the other nodes
+	recent := entry("b", models.SnapshotTypeFull, 2000)
+	recent.Timestamp = now.Add(-time.Hour)
+	metadataList = append(metadataList, entry("b", models.SnapshotTypeFull, 1000), recent)
+	for _, slot := range []int64{8900, 9000} {
+		metadataList = append(metadataList, entry("a", models.SnapshotTypeIncremental, slot))
+	}
+	// The default snapshot types set the node to the hash in the file name,
+	// which says nothing about the producer
+	metadataList = append(metadataList,
+		models.Metadata{FileName: "no-node", Slot: 9999},
+		models.Metadata{FileName: "snapshot-9999-" + testNode + ".tar.zst", Node: testNode, FileHash: testNode, Slot: 9999},
+		models.Metadata{FileName: "no-slot", UploadedBy: "a"},
+	)
+
+	times := map[string]time.Time{
+		entry("a", models.SnapshotTypeFull, 9000).FileName: now.Add(-2 * time.Hour),
+	}
+	nodes, skipped := analyzeCadence(metadataList, times, cadenceThresholds{staleSlots: 5000, staleAfter: 3 * time.Hour, gaps: 1}, now)
+
+	if len(nodes) != 3 || skipped != 2 {
+		t.Fatalf("analyzeCadence() returned %d nodes, skipped %d, want 3, 2: %+v", len(nodes), skipped, nodes)
+	}
+
+	a := nodes[0]
+	if a.Node != "a" || a.SnapshotType != models.SnapshotTypeFull {
+		t.Fatalf("nodes[0] = %s %s, want a full", a.Node, a.SnapshotType)
+	}
+	if a.Count != 6 || a.FirstSlot != 1000 || a.LatestSlot != 9000 || a.Interval != 1000 {
+		t.Errorf("node a = %+v", a)
+	}
+	if a.Missed != 3 {
+		t.Errorf("node a missed = %d, want 3", a.Missed)
+	}
+	wantGaps := []SlotGap{{FromSlot: 3000, ToSlot: 6000, Slots: 3000, Missed: 2}}
+	if !reflect.DeepEqual(a.Gaps, wantGaps) {
+		t.Errorf("node a gaps = %+v, want %+v", a.Gaps, wantGaps)
+	}
+	if a.Stale || a.LatestTime == nil || !a.LatestTime.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("node a stale = %v, latest time = %v", a.Stale, a.LatestTime)
+	}
+
+	incremental := nodes[1]
+	if incremental.SnapshotType != models.SnapshotTypeIncremental || incremental.SlotLag != 0 || incremental.Interval != 100 {
+		t.Errorf("node a incremental = %+v", incremental)
+	}
+
+	b := nodes[2]
+	if b.SlotLag != 7000 || !b.Stale || len(b.Gaps) != 0 {
+		t.Errorf("node b = %+v, want stale with a slot lag of 7000", b)
+	}
+}
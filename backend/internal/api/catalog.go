@@ -0,0 +1,590 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/artifact"
+	"github.com/blockdaemon/s3-bucket-browser/internal/index"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/schema"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+// indexWorkers is the number of metadata files fetched in parallel
+const indexWorkers = 10
+
+// metadataParserVersion is bumped whenever parseMetadata changes what it
+// extracts, which discards indexed entries built by older versions
+const metadataParserVersion = 7
+
+// errInvalidMetadata is returned for metadata files that cannot be parsed
+var errInvalidMetadata = errors.New("invalid metadata")
+
+// SyncResult summarizes the changes made by a catalog sync
+type SyncResult struct {
+	Objects int
+	Added   int
+	Updated int
+	Removed int
+	Failed  int
+	// ListingChanged is set when any object was added, removed or modified
+	ListingChanged bool
+}
+
+// MetadataChanged reports whether the sync changed any metadata entry
+func (r *SyncResult) MetadataChanged() bool {
+	return r.Added > 0 || r.Updated > 0 || r.Removed > 0
+}
+
+// Catalog holds the latest object listing of a source and an entry for every
+// artifact in it. An artifact's entry is keyed by its sidecar metadata file
+// if that is listed and parsed from it, and keyed by the artifact itself and
+// built from its name otherwise. Syncing only fetches metadata files whose
+// ETag changed since the last sync, and validates them against the schema.
+// If an index is attached, every sync is written to it.
+type Catalog struct {
+	objects      []storage.Object
+	objectsByKey map[string]storage.Object
+	entries      map[string]index.Entry
+	failed       map[string]string
+	problems     map[string][]schema.Problem
+	syncedAt     time.Time
+	partial      bool
+	resetPending bool
+	db           *index.DB
+	source       string
+	registry     *artifact.Registry
+	schema       *schema.Schema
+	mutex        sync.RWMutex
+	syncLock     sync.Mutex
+}
+
+// NewCatalog creates a new, empty catalog
+func NewCatalog() *Catalog {
+	return &Catalog{
+		objects:      []storage.Object{},
+		objectsByKey: make(map[string]storage.Object),
+		entries:      make(map[string]index.Entry),
+		failed:       make(map[string]string),
+		problems:     make(map[string][]schema.Problem),
+		registry:     artifact.DefaultRegistry(),
+		schema:       schema.Default(),
+	}
+}
+
+// AttachIndex restores the catalog of a source from the on-disk index and
+// writes every later sync back to it
+func (c *Catalog) AttachIndex(db *index.DB, source string) error {
+	snapshot, err := db.Load(source)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.db = db
+	c.source = source
+
+	if snapshot == nil {
+		return nil
+	}
+	if snapshot.State.ParserVersion != metadataParserVersion {
+		log.Printf("Index of source %s was built by metadata parser version %d, rebuilding it with version %d",
+			source, snapshot.State.ParserVersion, metadataParserVersion)
+		c.resetPending = true
+		return nil
+	}
+	if snapshot.State.ArtifactTypes != c.registry.Fingerprint() {
+		log.Printf("Artifact types of source %s changed since it was indexed, rebuilding its index", source)
+		c.resetPending = true
+		return nil
+	}
+	if snapshot.State.Schema != c.schema.Fingerprint() {
+		log.Printf("Metadata schema of source %s changed since it was indexed, rebuilding its index", source)
+		c.resetPending = true
+		return nil
+	}
+
+	c.setObjects(snapshot.Objects)
+	c.entries = snapshot.Entries
+	c.syncedAt = snapshot.State.SyncedAt
+	if snapshot.State.Invalid != nil {
+		c.failed = snapshot.State.Invalid
+	}
+	if snapshot.State.Problems != nil {
+		c.problems = snapshot.State.Problems
+	}
+
+	return nil
+}
+
+// Objects returns the latest object listing
+func (c *Catalog) Objects() []storage.Object {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.objects
+}
+
+// Object returns a listed object by its key
+func (c *Catalog) Object(key string) (storage.Object, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	obj, ok := c.objectsByKey[key]
+	return obj, ok
+}
+
+// setObjects replaces the listing. The caller must hold the write lock.
+func (c *Catalog) setObjects(objects []storage.Object) {
+	c.objects = objects
+	c.objectsByKey = make(map[string]storage.Object, len(objects))
+	for _, obj := range objects {
+		c.objectsByKey[obj.Key] = obj
+	}
+}
+
+// Metadata returns a copy of all metadata entries ordered by key
+func (c *Catalog) Metadata() []models.Metadata {
+	c.mutex.RLock()
+	metadataList := make([]models.Metadata, 0, len(c.entries))
+	for _, entry := range c.entries {
+		metadataList = append(metadataList, entry.Metadata)
+	}
+	c.mutex.RUnlock()
+
+	sort.Slice(metadataList, func(i, j int) bool {
+		return metadataList[i].FileName < metadataList[j].FileName
+	})
+
+	return metadataList
+}
+
+// Get returns the metadata entry for a key
+func (c *Catalog) Get(key string) (models.Metadata, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	entry, ok := c.entries[key]
+	return entry.Metadata, ok
+}
+
+// ArtifactObject is a listed artifact paired with its catalog entry
+type ArtifactObject struct {
+	Object   storage.Object
+	Metadata models.Metadata
+}
+
+// Artifacts returns every listed artifact that has a catalog entry. Sidecar
+// metadata files are not artifacts themselves and are left out.
+func (c *Catalog) Artifacts() []ArtifactObject {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var artifacts []ArtifactObject
+	for _, obj := range c.objects {
+		match, ok := c.registry.Match(obj.Key)
+		if !ok || match.MetadataKey == obj.Key {
+			continue
+		}
+
+		entry, ok := c.entries[match.MetadataKey]
+		if !ok {
+			entry, ok = c.entries[obj.Key]
+		}
+		if ok {
+			artifacts = append(artifacts, ArtifactObject{Object: obj, Metadata: entry.Metadata})
+		}
+	}
+	return artifacts
+}
+
+// SetVerification records the result of verifying an artifact on its entry,
+// found by the artifact's key or its metadata file's. It reports whether the
+// artifact has an entry.
+func (c *Catalog) SetVerification(key string, verification models.Verification) bool {
+	c.mutex.Lock()
+	entryKey := key
+	entry, ok := c.entries[entryKey]
+	if !ok {
+		if match, matched := c.registry.Match(key); matched && match.MetadataKey != "" {
+			entryKey = match.MetadataKey
+			entry, ok = c.entries[entryKey]
+		}
+	}
+	if ok {
+		entry.Metadata.Verification = &verification
+		c.entries[entryKey] = entry
+	}
+	db := c.db
+	c.mutex.Unlock()
+
+	if ok && db != nil {
+		if err := db.PutEntry(c.source, entryKey, entry); err != nil {
+			log.Printf("Failed to write the verification of %s to the index of source %s: %v", key, c.source, err)
+		}
+	}
+	return ok
+}
+
+// FileProblems lists the ways in which a metadata file does not conform to
+// the schema
+type FileProblems struct {
+	Key      string           `json:"key"`
+	Problems []schema.Problem `json:"problems"`
+}
+
+// Problems returns the metadata files with problems ordered by key
+func (c *Catalog) Problems() []FileProblems {
+	c.mutex.RLock()
+	files := make([]FileProblems, 0, len(c.problems))
+	for key, problems := range c.problems {
+		files = append(files, FileProblems{Key: key, Problems: problems})
+	}
+	c.mutex.RUnlock()
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	return files
+}
+
+// Len returns the number of metadata entries
+func (c *Catalog) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return len(c.entries)
+}
+
+// SyncedAt returns the time of the last successful sync
+func (c *Catalog) SyncedAt() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.syncedAt
+}
+
+// Partial reports whether the listing of the last sync was incomplete, as
+// when it failed part way or stopped at the object cap
+func (c *Catalog) Partial() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.partial
+}
+
+// Reset drops all metadata entries so the next sync fetches every file again
+func (c *Catalog) Reset() {
+	c.mutex.Lock()
+	c.entries = make(map[string]index.Entry)
+	c.failed = make(map[string]string)
+	c.problems = make(map[string][]schema.Problem)
+	c.resetPending = true
+	c.mutex.Unlock()
+}
+
+// Sync lists the store and brings the catalog up to date, fetching only the
+// metadata files that are new or whose ETag changed. Files that cannot be
+// parsed are not fetched again until their ETag changes. If the listing is
+// partial, entries that were not listed are kept and the error is returned
+// along with the result.
+func (c *Catalog) Sync(ctx context.Context, store storage.ObjectStore) (*SyncResult, error) {
+	// Only one sync may run at a time, otherwise files would be fetched twice
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	objects, listErr := store.ListObjects(ctx, "")
+	var partialErr *storage.PartialListError
+	if listErr != nil && !errors.As(listErr, &partialErr) {
+		return nil, listErr
+	}
+	partial := listErr != nil
+
+	result := &SyncResult{Objects: len(objects)}
+
+	// Work out which entries need to be built
+	c.mutex.RLock()
+	result.ListingChanged = listingChanged(c.objects, objects)
+	listed := make(map[string]bool, len(objects))
+	known := make(map[string]bool)
+	var stale []artifactEntry
+	for _, entry := range c.artifactEntries(objects) {
+		key := entry.object.Key
+		listed[key] = true
+
+		if existing, ok := c.entries[key]; ok {
+			if existing.ETag == entry.object.ETag {
+				continue
+			}
+			known[key] = true
+		} else if etag, ok := c.failed[key]; ok && etag == entry.object.ETag {
+			continue
+		}
+		stale = append(stale, entry)
+	}
+
+	var removed []string
+	if !partial {
+		for key := range c.entries {
+			if !listed[key] {
+				removed = append(removed, key)
+			}
+		}
+	}
+	c.mutex.RUnlock()
+
+	fetched, invalid, problems := fetchMetadata(ctx, store, stale, c.schema)
+	result.Failed = len(stale) - len(fetched)
+	result.Removed = len(removed)
+
+	c.mutex.Lock()
+	for key, entry := range fetched {
+		if known[key] {
+			result.Updated++
+		} else {
+			result.Added++
+		}
+		c.entries[key] = entry
+		delete(c.failed, key)
+		delete(c.problems, key)
+	}
+	for key, etag := range invalid {
+		c.failed[key] = etag
+	}
+	for key, fileProblems := range problems {
+		c.problems[key] = fileProblems
+	}
+	for _, key := range removed {
+		delete(c.entries, key)
+	}
+	if !partial {
+		for key := range c.failed {
+			if !listed[key] {
+				delete(c.failed, key)
+			}
+		}
+		for key := range c.problems {
+			if !listed[key] {
+				delete(c.problems, key)
+			}
+		}
+	}
+	replaceListing := !partial || len(c.objects) == 0
+	if replaceListing {
+		c.setObjects(objects)
+	}
+	c.syncedAt = time.Now()
+	c.partial = partial
+
+	var change *index.Change
+	if c.db != nil {
+		change = &index.Change{
+			Reset:  c.resetPending,
+			Put:    fetched,
+			Delete: removed,
+			State: index.State{
+				SyncedAt:      c.syncedAt,
+				ParserVersion: metadataParserVersion,
+				ArtifactTypes: c.registry.Fingerprint(),
+				Schema:        c.schema.Fingerprint(),
+				Invalid:       make(map[string]string, len(c.failed)),
+				Problems:      make(map[string][]schema.Problem, len(c.problems)),
+			},
+		}
+		if replaceListing && result.ListingChanged {
+			change.Objects = objects
+		}
+		for key, etag := range c.failed {
+			change.State.Invalid[key] = etag
+		}
+		for key, fileProblems := range c.problems {
+			change.State.Problems[key] = fileProblems
+		}
+		c.resetPending = false
+	}
+	c.mutex.Unlock()
+
+	if change != nil {
+		if err := c.db.Update(c.source, change); err != nil {
+			log.Printf("Failed to write the index of source %s: %v", c.source, err)
+		}
+	}
+
+	return result, listErr
+}
+
+// artifactEntry is the object a catalog entry is built from: the sidecar
+// metadata file of an artifact, or the artifact itself if it has none
+type artifactEntry struct {
+	object  storage.Object
+	match   artifact.Match
+	sidecar bool
+}
+
+// artifactEntries matches a listing against the artifact types and returns
+// one entry per artifact, merging artifacts with their sidecar files
+func (c *Catalog) artifactEntries(objects []storage.Object) []artifactEntry {
+	byKey := make(map[string]storage.Object, len(objects))
+	for _, obj := range objects {
+		byKey[obj.Key] = obj
+	}
+
+	seen := make(map[string]bool)
+	var entries []artifactEntry
+	for _, obj := range objects {
+		match, ok := c.registry.Match(obj.Key)
+		if !ok {
+			continue
+		}
+
+		entry := artifactEntry{object: obj, match: match}
+		if sidecar, ok := byKey[match.MetadataKey]; ok {
+			entry.object = sidecar
+			entry.sidecar = true
+		}
+		if seen[entry.object.Key] {
+			continue
+		}
+		seen[entry.object.Key] = true
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// listingChanged reports whether two listings differ in keys or ETags
+func listingChanged(old, current []storage.Object) bool {
+	if len(old) != len(current) {
+		return true
+	}
+
+	etags := make(map[string]string, len(old))
+	for _, obj := range old {
+		etags[obj.Key] = obj.ETag
+	}
+	for _, obj := range current {
+		if etag, ok := etags[obj.Key]; !ok || etag != obj.ETag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fetchMetadata builds catalog entries, fetching, validating and parsing
+// sidecar metadata files using a worker pool. Files that cannot be fetched or
+// parsed are logged and left out; the ones that cannot be parsed are returned
+// with their ETag. The problems of files that do not conform to the schema
+// are returned by key.
+func fetchMetadata(ctx context.Context, store storage.ObjectStore, artifacts []artifactEntry, validator *schema.Schema) (map[string]index.Entry, map[string]string, map[string][]schema.Problem) {
+	entries := make(map[string]index.Entry, len(artifacts))
+	failed := make(map[string]string)
+	problems := make(map[string][]schema.Problem)
+	if len(artifacts) == 0 {
+		return entries, failed, problems
+	}
+
+	filesChan := make(chan artifactEntry, len(artifacts))
+	var wg sync.WaitGroup
+	var mapMutex sync.Mutex
+
+	for i := 0; i < indexWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for item := range filesChan {
+				obj := item.object
+				metadata := models.Metadata{FileName: obj.Key, FileSize: obj.Size}
+				var fileProblems []schema.Problem
+				var err error
+				if item.sidecar {
+					metadata, fileProblems, err = fetchMetadataFile(ctx, store, obj, validator)
+				}
+				if len(fileProblems) > 0 {
+					mapMutex.Lock()
+					problems[obj.Key] = fileProblems
+					mapMutex.Unlock()
+				}
+				if err != nil {
+					log.Printf("Failed to index metadata file %s: %v", obj.Key, err)
+					if errors.Is(err, errInvalidMetadata) {
+						mapMutex.Lock()
+						failed[obj.Key] = obj.ETag
+						mapMutex.Unlock()
+					}
+					continue
+				}
+
+				applyArtifact(&metadata, item.match)
+
+				mapMutex.Lock()
+				entries[obj.Key] = index.Entry{ETag: obj.ETag, Metadata: metadata}
+				mapMutex.Unlock()
+			}
+		}()
+	}
+
+	for _, item := range artifacts {
+		filesChan <- item
+	}
+	close(filesChan)
+
+	wg.Wait()
+
+	return entries, failed, problems
+}
+
+// fetchMetadataFile fetches, validates and parses a single metadata file. A
+// file that cannot be parsed has a single parse error problem.
+func fetchMetadataFile(ctx context.Context, store storage.ObjectStore, obj storage.Object, validator *schema.Schema) (models.Metadata, []schema.Problem, error) {
+	result, err := store.GetObject(ctx, obj.Key)
+	if err != nil {
+		return models.Metadata{}, nil, err
+	}
+
+	body, err := io.ReadAll(result.Body)
+	result.Body.Close()
+	if err != nil {
+		return models.Metadata{}, nil, err
+	}
+
+	metadata, err := parseMetadata(obj.Key, body)
+	if err != nil {
+		return metadata, []schema.Problem{{Class: schema.ClassParseError, Message: err.Error()}}, err
+	}
+	return metadata, validator.Validate(body), nil
+}
+
+// parseMetadata parses the content of a metadata file. Fields derived from
+// the file name are applied separately by applyArtifact. Fields whose values
+// have the wrong type are left unset.
+func parseMetadata(key string, body []byte) (models.Metadata, error) {
+	metadata := models.Metadata{FileName: key}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return metadata, fmt.Errorf("%w: %v", errInvalidMetadata, err)
+	}
+
+	for _, fieldErr := range decodeMetadata(fields, &metadata) {
+		log.Printf("Ignoring %s of metadata file %s: %v", fieldErr.Field, key, fieldErr.Err)
+	}
+
+	return metadata, nil
+}
+
+// applyArtifact sets the fields derived from an artifact's key on metadata
+func applyArtifact(metadata *models.Metadata, match artifact.Match) {
+	match.Apply(metadata)
+	if match.HasField("slot") {
+		metadata.SlotRange = getSlotRange(metadata.Slot)
+	}
+}
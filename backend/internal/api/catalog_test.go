@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/index"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+const testNode = "AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96"
+
+// countingStore counts the objects fetched from the wrapped store
+type countingStore struct {
+	*storage.MemoryStore
+	gets atomic.Int32
+}
+
+func (c *countingStore) GetObject(ctx context.Context, key string) (*storage.ObjectReader, error) {
+	c.gets.Add(1)
+	return c.MemoryStore.GetObject(ctx, key)
+}
+
+func putObject(t *testing.T, store storage.Writer, key, body string) {
+	t.Helper()
+	if err := store.PutObject(context.Background(), key, strings.NewReader(body)); err != nil {
+		t.Fatalf("PutObject(%q) error = %v", key, err)
+	}
+}
+
+func TestCatalogSync(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryStore: storage.NewMemoryStore()}
+	catalog := NewCatalog()
+
+	first := "snapshot-100-" + testNode + ".json"
+	second := "snapshot-200-" + testNode + ".json"
+	broken := "snapshot-300-" + testNode + ".json"
+	putObject(t, store, first, `{"solana_version":"1.18.1","status":"ok"}`)
+	putObject(t, store, second, `{"solana_version":"1.18.2","status":"ok"}`)
+	putObject(t, store, broken, `not json`)
+	putObject(t, store, "snapshot-100-"+testNode+".tar.gz", "archive")
+	putObject(t, store, "notes.txt", "not an artifact")
+
+	result, err := catalog.Sync(ctx, store)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Added != 2 || result.Failed != 1 || !result.ListingChanged || catalog.Len() != 2 {
+		t.Errorf("first Sync() = %+v, want 2 added and 1 failed", result)
+	}
+	if got := store.gets.Load(); got != 3 {
+		t.Errorf("first Sync() fetched %d files, want 3", got)
+	}
+
+	metadata, ok := catalog.Get(first)
+	if !ok || metadata.SolanaVersion != "1.18.1" || metadata.Slot != 100 || metadata.Node != testNode {
+		t.Errorf("Get(%q) = %+v, %v", first, metadata, ok)
+	}
+
+	// Nothing changed, so nothing is fetched again, including the broken file
+	store.gets.Store(0)
+	result, err = catalog.Sync(ctx, store)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.MetadataChanged() || result.ListingChanged || store.gets.Load() != 0 {
+		t.Errorf("unchanged Sync() = %+v after %d fetches, want no changes", result, store.gets.Load())
+	}
+
+	// Only the modified file is fetched, and deleted files are dropped. The
+	// archive whose metadata file was deleted is kept with what its name says.
+	putObject(t, store, second, `{"solana_version":"1.18.3","status":"ok"}`)
+	if err := store.DeleteObject(ctx, first); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	result, err = catalog.Sync(ctx, store)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Updated != 1 || result.Removed != 1 || result.Added != 1 || store.gets.Load() != 1 {
+		t.Errorf("incremental Sync() = %+v after %d fetches, want 1 updated, 1 removed and 1 added", result, store.gets.Load())
+	}
+	// The metadata file declares no file_size, so the entry has none
+	if metadata, _ := catalog.Get(second); metadata.SolanaVersion != "1.18.3" || metadata.FileSize != 0 || metadata.FileSizeDeclared {
+		t.Errorf("Get(%q) = %+v, want version 1.18.3 without a file size", second, metadata)
+	}
+	if _, ok := catalog.Get(first); ok {
+		t.Errorf("Get(%q) found a deleted file", first)
+	}
+	archive := "snapshot-100-" + testNode + ".tar.gz"
+	if metadata, ok := catalog.Get(archive); !ok || metadata.Slot != 100 || metadata.ArtifactType != "snapshot" || metadata.FileSize != 7 {
+		t.Errorf("Get(%q) = %+v, %v, want the archive described by its name", archive, metadata, ok)
+	}
+	if catalog.Len() != 2 || len(catalog.Objects()) != 4 {
+		t.Errorf("catalog has %d entries and %d objects, want 2 and 4", catalog.Len(), len(catalog.Objects()))
+	}
+}
+
+func TestCatalogRestoreFromIndex(t *testing.T) {
+	ctx := context.Background()
+	db, err := index.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	store := &countingStore{MemoryStore: storage.NewMemoryStore()}
+	key := "snapshot-100-" + testNode + ".json"
+	putObject(t, store, key, `{"solana_version":"1.18.1"}`)
+
+	first := NewCatalog()
+	if err := first.AttachIndex(db, "mainnet"); err != nil {
+		t.Fatalf("AttachIndex() error = %v", err)
+	}
+	if _, err := first.Sync(ctx, store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	// A new catalog comes up with the indexed data and does not refetch it
+	restored := NewCatalog()
+	if err := restored.AttachIndex(db, "mainnet"); err != nil {
+		t.Fatalf("AttachIndex() error = %v", err)
+	}
+	if metadata, ok := restored.Get(key); !ok || metadata.SolanaVersion != "1.18.1" {
+		t.Errorf("restored Get(%q) = %+v, %v", key, metadata, ok)
+	}
+	if len(restored.Objects()) != 1 || restored.SyncedAt().IsZero() {
+		t.Errorf("restored catalog has %d objects, synced at %v", len(restored.Objects()), restored.SyncedAt())
+	}
+	if problems := restored.Problems(); len(problems) != 1 || problems[0].Key != key {
+		t.Errorf("restored Problems() = %+v, want the missing fields of %s", problems, key)
+	}
+
+	store.gets.Store(0)
+	result, err := restored.Sync(ctx, store)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.MetadataChanged() || store.gets.Load() != 0 {
+		t.Errorf("Sync() after restore = %+v after %d fetches, want no changes", result, store.gets.Load())
+	}
+}
+
+func TestCatalogRebuildsIndexOfOlderParser(t *testing.T) {
+	ctx := context.Background()
+	db, err := index.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	key := "incremental-snapshot-100-150-" + testNode + ".json"
+	stale := &index.Change{
+		Objects: []storage.Object{storage.NewObject(key, 10, time.Time{}, "etag")},
+		Put:     map[string]index.Entry{key: {ETag: "etag"}},
+		State:   index.State{SyncedAt: time.Now(), ParserVersion: metadataParserVersion - 1},
+	}
+	if err := db.Update("mainnet", stale); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	store := &countingStore{MemoryStore: storage.NewMemoryStore()}
+	putObject(t, store, key, `{"solana_version":"1.18.1"}`)
+
+	catalog := NewCatalog()
+	if err := catalog.AttachIndex(db, "mainnet"); err != nil {
+		t.Fatalf("AttachIndex() error = %v", err)
+	}
+	if catalog.Len() != 0 || !catalog.SyncedAt().IsZero() {
+		t.Fatalf("AttachIndex() restored %d entries from an older parser", catalog.Len())
+	}
+
+	if _, err := catalog.Sync(ctx, store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	metadata, ok := catalog.Get(key)
+	if !ok || metadata.SnapshotType != "incremental" || metadata.BaseSlot != 100 || metadata.Slot != 150 {
+		t.Errorf("Get(%q) = %+v, %v, want an incremental snapshot of slot 150 based on 100", key, metadata, ok)
+	}
+
+	snapshot, err := db.Load("mainnet")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if snapshot.State.ParserVersion != metadataParserVersion || snapshot.Entries[key].Metadata.BaseSlot != 100 {
+		t.Errorf("Load() = parser version %d and entry %+v after rebuild", snapshot.State.ParserVersion, snapshot.Entries[key])
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// CompatibilityMatrix relates the Solana versions that produced snapshots to
+// their feature sets
+type CompatibilityMatrix struct {
+	Versions    []string            `json:"versions"`
+	FeatureSets []int               `json:"feature_sets"`
+	Cells       []CompatibilityCell `json:"cells"`
+}
+
+// CompatibilityCell counts the snapshots of one version and feature set and
+// the slots they cover. An empty version or a zero feature set stands for
+// snapshots whose metadata does not include it.
+type CompatibilityCell struct {
+	SolanaVersion    string `json:"solana_version"`
+	SolanaFeatureSet int    `json:"solana_feature_set"`
+	Count            int    `json:"count"`
+	MinSlot          int64  `json:"min_slot"`
+	MaxSlot          int64  `json:"max_slot"`
+}
+
+// buildCompatibilityMatrix groups metadata by version and feature set.
+// Entries with neither are left out.
+func buildCompatibilityMatrix(metadataList []models.Metadata) CompatibilityMatrix {
+	type pair struct {
+		version    string
+		featureSet int
+	}
+	cells := make(map[pair]*CompatibilityCell)
+	versions := make(map[string]bool)
+	featureSets := make(map[int]bool)
+
+	for _, metadata := range metadataList {
+		if metadata.SolanaVersion == "" && metadata.SolanaFeatureSet == 0 {
+			continue
+		}
+
+		key := pair{version: metadata.SolanaVersion, featureSet: metadata.SolanaFeatureSet}
+		cell, ok := cells[key]
+		if !ok {
+			cell = &CompatibilityCell{
+				SolanaVersion:    metadata.SolanaVersion,
+				SolanaFeatureSet: metadata.SolanaFeatureSet,
+				MinSlot:          metadata.Slot,
+				MaxSlot:          metadata.Slot,
+			}
+			cells[key] = cell
+			versions[metadata.SolanaVersion] = true
+			featureSets[metadata.SolanaFeatureSet] = true
+		}
+		cell.Count++
+		cell.MinSlot = min(cell.MinSlot, metadata.Slot)
+		cell.MaxSlot = max(cell.MaxSlot, metadata.Slot)
+	}
+
+	matrix := CompatibilityMatrix{
+		Versions:    make([]string, 0, len(versions)),
+		FeatureSets: make([]int, 0, len(featureSets)),
+		Cells:       make([]CompatibilityCell, 0, len(cells)),
+	}
+	for version := range versions {
+		matrix.Versions = append(matrix.Versions, version)
+	}
+	sort.Slice(matrix.Versions, func(i, j int) bool {
+		return models.CompareVersions(matrix.Versions[i], matrix.Versions[j]) < 0
+	})
+	for featureSet := range featureSets {
+		matrix.FeatureSets = append(matrix.FeatureSets, featureSet)
+	}
+	sort.Ints(matrix.FeatureSets)
+
+	for _, cell := range cells {
+		matrix.Cells = append(matrix.Cells, *cell)
+	}
+	sort.Slice(matrix.Cells, func(i, j int) bool {
+		a, b := matrix.Cells[i], matrix.Cells[j]
+		if c := models.CompareVersions(a.SolanaVersion, b.SolanaVersion); c != 0 {
+			return c < 0
+		}
+		return a.SolanaFeatureSet < b.SolanaFeatureSet
+	})
+
+	return matrix
+}
+
+// GetCompatibility returns the matrix of Solana versions and feature sets
+// with the number of snapshots and the slots observed for each. The metadata
+// filters select the entries that are counted.
+func (h *Handler) GetCompatibility(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	metadataList, err := filterMetadata(r, source)
+	if err != nil {
+		log.Printf("GetCompatibility: Invalid query: %v", err)
+		respondWithQueryError(w, err)
+		return
+	}
+
+	matrix := buildCompatibilityMatrix(metadataList)
+
+	log.Printf("GetCompatibility: %d versions and %d feature sets in source %s",
+		len(matrix.Versions), len(matrix.FeatureSets), source.Name)
+
+	respondWithJSON(w, http.StatusOK, matrix)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetCompatibility(t *testing.T) {
+	router := newMetadataRouter(t, map[string]string{
+		"snapshot-100-" + testNode + ".json": `{"solana_version":"1.18.2","solana_feature_set":3469865029}`,
+		"snapshot-200-" + testNode + ".json": `{"solana_version":"1.18.2","solana_feature_set":3469865029}`,
+		// A feature set written as a string is parsed by the fallback
+		"snapshot-300-" + testNode + ".json": `{"solana_version":"1.18.10","solana_feature_set":"4215500110"}`,
+		"snapshot-400-" + testNode + ".json": `{"solana_version":"1.17.9"}`,
+		"snapshot-500-" + testNode + ".json": `{}`,
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want CompatibilityMatrix
+	}{
+		{
+			name: "all snapshots",
+			path: "/api/analysis/compatibility",
+			want: CompatibilityMatrix{
+				Versions:    []string{"1.17.9", "1.18.2", "1.18.10"},
+				FeatureSets: []int{0, 3469865029, 4215500110},
+				Cells: []CompatibilityCell{
+					{SolanaVersion: "1.17.9", Count: 1, MinSlot: 400, MaxSlot: 400},
+					{SolanaVersion: "1.18.2", SolanaFeatureSet: 3469865029, Count: 2, MinSlot: 100, MaxSlot: 200},
+					{SolanaVersion: "1.18.10", SolanaFeatureSet: 4215500110, Count: 1, MinSlot: 300, MaxSlot: 300},
+				},
+			},
+		},
+		{
+			name: "filtered by feature set",
+			path: "/api/analysis/compatibility?solanaFeatureSet=4215500110",
+			want: CompatibilityMatrix{
+				Versions:    []string{"1.18.10"},
+				FeatureSets: []int{4215500110},
+				Cells: []CompatibilityCell{
+					{SolanaVersion: "1.18.10", SolanaFeatureSet: 4215500110, Count: 1, MinSlot: 300, MaxSlot: 300},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s code = %d, want %d", tt.path, rec.Code, http.StatusOK)
+			}
+
+			var matrix CompatibilityMatrix
+			if err := json.Unmarshal(rec.Body.Bytes(), &matrix); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(matrix, tt.want) {
+				t.Errorf("GET %s = %+v, want %+v", tt.path, matrix, tt.want)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/options?solanaFeatureSet=3469865029", nil))
+	var options FilterOptions
+	if err := json.Unmarshal(rec.Body.Bytes(), &options); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !reflect.DeepEqual(options.FeatureSets, []int{3469865029}) || options.Counts.FeatureSets["3469865029"] != 2 {
+		t.Errorf("GET /api/metadata/options feature sets = %v with counts %v", options.FeatureSets, options.Counts.FeatureSets)
+	}
+}
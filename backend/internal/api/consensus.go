@@ -0,0 +1,256 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// alertHashMismatch is the kind of alert sent when snapshots of a slot
+// disagree on the hash
+const alertHashMismatch = "hash_mismatch"
+
+// alertFileHashMismatch is the kind of alert sent when the hash field of a
+// metadata file disagrees with the hash in its file name
+const alertFileHashMismatch = "file_hash_mismatch"
+
+// HashConflict is a slot for which snapshots of the same type disagree on
+// the hash
+type HashConflict struct {
+	Slot         int64      `json:"slot"`
+	SnapshotType string     `json:"snapshot_type,omitempty"`
+	BaseSlot     int64      `json:"base_slot,omitempty"`
+	Sides        []HashSide `json:"sides"`
+}
+
+// HashSide lists the nodes and files that agree on one hash
+type HashSide struct {
+	Hash  string   `json:"hash"`
+	Nodes []string `json:"nodes"`
+	Files []string `json:"files"`
+}
+
+// HashMismatch is a snapshot whose metadata hash field disagrees with the
+// hash segment of its file name
+type HashMismatch struct {
+	File         string `json:"file"`
+	Slot         int64  `json:"slot"`
+	SnapshotType string `json:"snapshot_type,omitempty"`
+	Node         string `json:"node,omitempty"`
+	FileHash     string `json:"file_hash"`
+	MetadataHash string `json:"metadata_hash"`
+}
+
+// ConsensusReport is the result of comparing snapshot hashes across nodes
+type ConsensusReport struct {
+	CheckedSlots   int            `json:"checked_slots"`
+	Conflicts      []HashConflict `json:"conflicts"`
+	HashMismatches []HashMismatch `json:"hash_mismatches"`
+}
+
+// key identifies a conflict by its slot and the hashes involved, so that it
+// is only alerted once
+func (c HashConflict) key() string {
+	hashes := make([]string, len(c.Sides))
+	for i, side := range c.Sides {
+		hashes[i] = side.Hash
+	}
+	return fmt.Sprintf("%s/%d/%d/%s", c.SnapshotType, c.BaseSlot, c.Slot, strings.Join(hashes, ","))
+}
+
+// key identifies a mismatch by its file and hashes, so that it is only
+// alerted once
+func (m HashMismatch) key() string {
+	return fmt.Sprintf("file/%s/%s,%s", m.File, m.FileHash, m.MetadataHash)
+}
+
+// snapshotHash returns the hash of a snapshot: the hash field of its
+// metadata file, or the hash segment of its file name if that has none
+func snapshotHash(metadata models.Metadata) string {
+	if metadata.Hash != "" {
+		return metadata.Hash
+	}
+	return metadata.FileHash
+}
+
+// findHashMismatches returns the snapshots whose metadata hash field
+// disagrees with the hash segment of their file name, ordered by slot and
+// file
+func findHashMismatches(metadataList []models.Metadata) []HashMismatch {
+	mismatches := []HashMismatch{}
+	for _, metadata := range metadataList {
+		if metadata.Hash == "" || metadata.FileHash == "" || metadata.Hash == metadata.FileHash {
+			continue
+		}
+		mismatches = append(mismatches, HashMismatch{
+			File:         metadata.FileName,
+			Slot:         metadata.Slot,
+			SnapshotType: metadata.SnapshotType,
+			Node:         metadata.Producer(),
+			FileHash:     metadata.FileHash,
+			MetadataHash: metadata.Hash,
+		})
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Slot != mismatches[j].Slot {
+			return mismatches[i].Slot < mismatches[j].Slot
+		}
+		return mismatches[i].File < mismatches[j].File
+	})
+	return mismatches
+}
+
+// findHashConflicts groups snapshots by slot and returns the slots with more
+// than one hash, ordered by slot. It also returns the number of slots
+// checked.
+func findHashConflicts(metadataList []models.Metadata) ([]HashConflict, int) {
+	type slotKey struct {
+		snapshotType string
+		baseSlot     int64
+		slot         int64
+	}
+	groups := make(map[slotKey]map[string]*HashSide)
+
+	for _, metadata := range metadataList {
+		hash := snapshotHash(metadata)
+		if metadata.Slot == 0 || hash == "" {
+			continue
+		}
+
+		key := slotKey{snapshotType: metadata.SnapshotType, baseSlot: metadata.BaseSlot, slot: metadata.Slot}
+		sides, ok := groups[key]
+		if !ok {
+			sides = make(map[string]*HashSide)
+			groups[key] = sides
+		}
+		side, ok := sides[hash]
+		if !ok {
+			side = &HashSide{Hash: hash}
+			sides[hash] = side
+		}
+		if node := metadata.Producer(); node != "" && !slices.Contains(side.Nodes, node) {
+			side.Nodes = append(side.Nodes, node)
+		}
+		side.Files = append(side.Files, metadata.FileName)
+	}
+
+	conflicts := []HashConflict{}
+	for key, sides := range groups {
+		if len(sides) < 2 {
+			continue
+		}
+
+		conflict := HashConflict{Slot: key.slot, SnapshotType: key.snapshotType, BaseSlot: key.baseSlot}
+		for _, side := range sides {
+			sort.Strings(side.Nodes)
+			sort.Strings(side.Files)
+			conflict.Sides = append(conflict.Sides, *side)
+		}
+		sort.Slice(conflict.Sides, func(i, j int) bool { return conflict.Sides[i].Hash < conflict.Sides[j].Hash })
+		conflicts = append(conflicts, conflict)
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		a, b := conflicts[i], conflicts[j]
+		if a.Slot != b.Slot {
+			return a.Slot < b.Slot
+		}
+		if a.SnapshotType != b.SnapshotType {
+			return a.SnapshotType < b.SnapshotType
+		}
+		return a.BaseSlot < b.BaseSlot
+	})
+
+	return conflicts, len(groups)
+}
+
+// checkConsensus looks for hash conflicts and file hash mismatches in a
+// source's catalog and alerts WebSocket clients of the ones that were not
+// reported before. It runs after every index, from the source's watch loop
+// and from reindex requests, so checks of a source are serialized.
+func (h *Handler) checkConsensus(source *Source) {
+	source.consensusLock.Lock()
+	defer source.consensusLock.Unlock()
+
+	metadataList := source.catalog.Metadata()
+	conflicts, _ := findHashConflicts(metadataList)
+	mismatches := findHashMismatches(metadataList)
+
+	reported := make(map[string]bool, len(conflicts)+len(mismatches))
+	for _, conflict := range conflicts {
+		key := conflict.key()
+		reported[key] = true
+		if source.reportedConflicts[key] {
+			continue
+		}
+
+		message := fmt.Sprintf("Snapshots of slot %d in source %s have %d different hashes",
+			conflict.Slot, source.Name, len(conflict.Sides))
+		log.Print(message)
+
+		source.hub.PublishAlert(Alert{
+			Type:     alertEventType,
+			Alert:    alertHashMismatch,
+			Source:   source.Name,
+			Message:  message,
+			Conflict: &conflict,
+		})
+	}
+	for _, mismatch := range mismatches {
+		key := mismatch.key()
+		reported[key] = true
+		if source.reportedConflicts[key] {
+			continue
+		}
+
+		message := fmt.Sprintf("Metadata hash of %s in source %s differs from the hash in its file name",
+			mismatch.File, source.Name)
+		log.Print(message)
+
+		source.hub.PublishAlert(Alert{
+			Type:     alertEventType,
+			Alert:    alertFileHashMismatch,
+			Source:   source.Name,
+			Message:  message,
+			Mismatch: &mismatch,
+		})
+	}
+	source.reportedConflicts = reported
+}
+
+// GetConsensus reports the slots whose snapshots disagree on the hash,
+// with the nodes on each side, and the snapshots whose metadata hash differs
+// from the hash in their file name. The metadata filters select the entries
+// that are compared.
+func (h *Handler) GetConsensus(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	metadataList, err := filterMetadata(r, source)
+	if err != nil {
+		log.Printf("GetConsensus: Invalid query: %v", err)
+		respondWithQueryError(w, err)
+		return
+	}
+
+	conflicts, checked := findHashConflicts(metadataList)
+	mismatches := findHashMismatches(metadataList)
+
+	log.Printf("GetConsensus: %d of %d slots in source %s have conflicting hashes, %d files disagree with their name",
+		len(conflicts), checked, source.Name, len(mismatches))
+
+	respondWithJSON(w, http.StatusOK, ConsensusReport{CheckedSlots: checked, Conflicts: conflicts, HashMismatches: mismatches})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+func TestFindHashConflicts(t *testing.T) {
+	metadataList := []models.Metadata{
+		// Slot 100 agrees: the name segment is the hash when there is no hash field
+		{FileName: "a/snapshot-100-H1.json", Slot: 100, Node: "H1", FileHash: "H1", UploadedBy: "node-a", SnapshotType: "full"},
+		{FileName: "b/snapshot-100-H1.json", Slot: 100, Node: "H1", FileHash: "H1", UploadedBy: "node-b", SnapshotType: "full"},
+		// Slot 200 diverges, with the hash field taking precedence over the name
+		{FileName: "a/snapshot-200-H2.json", Slot: 200, Node: "H2", FileHash: "H2", UploadedBy: "node-a", SnapshotType: "full"},
+		{FileName: "b/snapshot-200-H2.json", Slot: 200, Node: "H2", FileHash: "H2", Hash: "H3", UploadedBy: "node-b", SnapshotType: "full"},
+		{FileName: "c/snapshot-200-H2.json", Slot: 200, Node: "H2", FileHash: "H2", Hash: "H3", UploadedBy: "node-c", SnapshotType: "full"},
+		// Without an uploader the node field is only the hash, so no node is named
+		{FileName: "d/snapshot-200-H2.json", Slot: 200, Node: "H2", FileHash: "H2", SnapshotType: "full"},
+		// An incremental snapshot of the same slot is compared separately
+		{FileName: "incremental-snapshot-100-200-H9.json", Slot: 200, BaseSlot: 100, Node: "H9", FileHash: "H9", SnapshotType: "incremental"},
+		{FileName: "notes.json"},
+	}
+
+	conflicts, checked := findHashConflicts(metadataList)
+	if checked != 3 {
+		t.Errorf("findHashConflicts() checked %d slots, want 3", checked)
+	}
+
+	want := []HashConflict{{
+		Slot:         200,
+		SnapshotType: "full",
+		Sides: []HashSide{
+			{Hash: "H2", Nodes: []string{"node-a"}, Files: []string{"a/snapshot-200-H2.json", "d/snapshot-200-H2.json"}},
+			{Hash: "H3", Nodes: []string{"node-b", "node-c"}, Files: []string{"b/snapshot-200-H2.json", "c/snapshot-200-H2.json"}},
+		},
+	}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("findHashConflicts() = %+v, want %+v", conflicts, want)
+	}
+}
+
+func TestFindHashMismatches(t *testing.T) {
+	metadataList := []models.Metadata{
+		{FileName: "b/snapshot-200-H2.json", Slot: 200, Node: "H2", FileHash: "H2", Hash: "H3", UploadedBy: "node-b", SnapshotType: "full"},
+		{FileName: "a/snapshot-100-H1.json", Slot: 100, Node: "H1", FileHash: "H1", Hash: "H1", UploadedBy: "node-a", SnapshotType: "full"},
+		{FileName: "a/snapshot-200-H2.json", Slot: 200, Node: "H2", FileHash: "H2", Hash: "H4", SnapshotType: "full"},
+		// Without a hash field or a hash in the name there is nothing to compare
+		{FileName: "c/snapshot-300-H5.json", Slot: 300, Node: "H5", FileHash: "H5", SnapshotType: "full"},
+		{FileName: "notes.json", Hash: "H6"},
+	}
+
+	want := []HashMismatch{
+		{File: "a/snapshot-200-H2.json", Slot: 200, SnapshotType: "full", FileHash: "H2", MetadataHash: "H4"},
+		{File: "b/snapshot-200-H2.json", Slot: 200, SnapshotType: "full", Node: "node-b", FileHash: "H2", MetadataHash: "H3"},
+	}
+	if got := findHashMismatches(metadataList); !reflect.DeepEqual(got, want) {
+		t.Errorf("findHashMismatches() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckConsensusAlertsOnce(t *testing.T) {
+	store := storage.NewMemoryStore()
+	putObject(t, store, "a/snapshot-100-"+testNode+".json", `{"uploaded_by":"node-a"}`)
+	putObject(t, store, "b/snapshot-100-"+testNode+".json", `{"hash":"other","uploaded_by":"node-b"}`)
+
+	source := NewSource("mainnet", config.BackendMemory, store)
+
+	// The client registers before the sync, so it is not sent a listing
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go source.hub.Run(ctx)
+	client := &Client{hub: source.hub, send: make(chan []byte, 4)}
+	source.hub.register <- client
+
+	if _, err := source.catalog.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	// Checks run from the watch loop and reindex requests at the same time
+	handler := &Handler{}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.checkConsensus(source)
+		}()
+	}
+	wg.Wait()
+
+	// The slot's conflict and the file disagreeing with its name are each
+	// alerted once
+	alerts := make(map[string]Alert)
+	for i := 0; i < 2; i++ {
+		select {
+		case message := <-client.send:
+			var alert Alert
+			if err := json.Unmarshal(message, &alert); err != nil {
+				t.Fatalf("failed to decode alert: %v", err)
+			}
+			alerts[alert.Alert] = alert
+		case <-time.After(time.Second):
+			t.Fatal("no alert was sent")
+		}
+	}
+	if alert := alerts[alertHashMismatch]; alert.Type != alertEventType || alert.Conflict == nil || alert.Conflict.Slot != 100 {
+		t.Errorf("conflict alert = %+v", alert)
+	}
+	if alert := alerts[alertFileHashMismatch]; alert.Mismatch == nil || alert.Mismatch.MetadataHash != "other" || alert.Mismatch.FileHash != testNode {
+		t.Errorf("mismatch alert = %+v", alert)
+	}
+
+	select {
+	case message := <-client.send:
+		t.Errorf("alert was sent again: %s", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// millisecondsThreshold separates unix timestamps in seconds from ones in
+// milliseconds: in seconds it is a date in the year 33658
+const millisecondsThreshold = 1e12
+
+// metadataDecoders decode the fields of a metadata file that have a field in
+// models.Metadata. Fields that are not listed are kept in Extra.
+var metadataDecoders = map[string]func(m *models.Metadata, value json.RawMessage) error{
+	"solana_version": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeString(value, &m.SolanaVersion)
+	},
+	"solana_feature_set": func(m *models.Metadata, value json.RawMessage) error {
+		n, err := decodeInt(value)
+		m.SolanaFeatureSet = int(n)
+		return err
+	},
+	"slot": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeIntField(value, &m.Slot)
+	},
+	"base_slot": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeIntField(value, &m.BaseSlot)
+	},
+	"file_size": func(m *models.Metadata, value json.RawMessage) error {
+		if err := decodeIntField(value, &m.FileSize); err != nil {
+			return err
+		}
+		m.FileSizeDeclared = true
+		return nil
+	},
+	"timestamp": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeTime(value, &m.Timestamp)
+	},
+	"uploaded_at": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeTime(value, &m.UploadedAt)
+	},
+	"hash": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeString(value, &m.Hash)
+	},
+	"status": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeString(value, &m.Status)
+	},
+	"uploaded_by": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeString(value, &m.UploadedBy)
+	},
+	"node": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeString(value, &m.Node)
+	},
+	"snapshot_type": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeString(value, &m.SnapshotType)
+	},
+	"artifact_type": func(m *models.Metadata, value json.RawMessage) error {
+		return decodeString(value, &m.ArtifactType)
+	},
+	// The file name and slot range are always those of the listed file
+	"file_name":  func(*models.Metadata, json.RawMessage) error { return nil },
+	"slot_range": func(*models.Metadata, json.RawMessage) error { return nil },
+}
+
+// FieldError is a field of a metadata file whose value has the wrong type
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// Error implements the error interface
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s: %v", e.Field, e.Err)
+}
+
+// decodeMetadata decodes the fields of a metadata file into metadata. Fields
+// with values of the wrong type are left unset and returned as errors.
+func decodeMetadata(fields map[string]json.RawMessage, metadata *models.Metadata) []*FieldError {
+	var fieldErrors []*FieldError
+	for name, value := range fields {
+		if isNull(value) {
+			continue
+		}
+
+		decode, ok := metadataDecoders[name]
+		if !ok {
+			var extra interface{}
+			if err := json.Unmarshal(value, &extra); err == nil {
+				if metadata.Extra == nil {
+					metadata.Extra = make(map[string]interface{})
+				}
+				metadata.Extra[name] = extra
+			}
+			continue
+		}
+		if err := decode(metadata, value); err != nil {
+			fieldErrors = append(fieldErrors, &FieldError{Field: name, Err: err})
+		}
+	}
+	return fieldErrors
+}
+
+// isNull reports whether a JSON value is null
+func isNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+// decodeString decodes a string. Numbers are taken as their literal text.
+func decodeString(value json.RawMessage, field *string) error {
+	if err := json.Unmarshal(value, field); err == nil {
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(value, &number); err != nil {
+		return fmt.Errorf("expected a string, got %s", value)
+	}
+	*field = number.String()
+	return nil
+}
+
+// decodeInt decodes an integer given as a number or a numeric string
+func decodeInt(value json.RawMessage) (int64, error) {
+	var number json.Number
+	if err := json.Unmarshal(value, &number); err != nil {
+		return 0, fmt.Errorf("expected an integer, got %s", value)
+	}
+	n, err := number.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer, got %s", value)
+	}
+	return n, nil
+}
+
+// decodeIntField decodes an integer into a field
+func decodeIntField(value json.RawMessage, field *int64) error {
+	n, err := decodeInt(value)
+	if err != nil {
+		return err
+	}
+	*field = n
+	return nil
+}
+
+// decodeTime decodes a time given as an RFC3339 string or as unix seconds or
+// milliseconds, which may be a number or a numeric string
+func decodeTime(value json.RawMessage, field *time.Time) error {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(text)); err == nil {
+			*field = t
+			return nil
+		}
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(value, &number); err != nil {
+		return fmt.Errorf("expected an RFC3339 time or a unix timestamp, got %s", value)
+	}
+	seconds, err := number.Float64()
+	if err != nil || seconds <= 0 {
+		return fmt.Errorf("expected an RFC3339 time or a unix timestamp, got %s", value)
+	}
+	if seconds >= millisecondsThreshold {
+		seconds /= 1000
+	}
+	whole, fraction := math.Modf(seconds)
+	*field = time.Unix(int64(whole), int64(fraction*1e9)).UTC()
+	return nil
+}
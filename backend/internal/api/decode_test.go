@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+func TestParseMetadata(t *testing.T) {
+	key := "snapshot-100-" + testNode + ".json"
+	timestamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		body string
+		want models.Metadata
+	}{
+		{
+			name: "all fields",
+			body: `{"solana_version":"1.18.1","solana_feature_set":3469865029,"slot":100,"hash":"abc",
+				"status":"ok","uploaded_by":"node-a","uploaded_at":"2024-03-01T12:00:00Z","file_size":42,
+				"file_name":"other.json"}`,
+			want: models.Metadata{
+				FileName: key, FileSize: 42, FileSizeDeclared: true, SolanaVersion: "1.18.1", SolanaFeatureSet: 3469865029,
+				Slot: 100, Hash: "abc", Status: "ok", UploadedBy: "node-a", UploadedAt: timestamp,
+			},
+		},
+		{
+			name: "unix seconds and numeric strings",
+			body: `{"timestamp":1709294400,"slot":"100","solana_feature_set":"7"}`,
+			want: models.Metadata{FileName: key, Slot: 100, SolanaFeatureSet: 7, Timestamp: timestamp},
+		},
+		{
+			name: "unix milliseconds as a string",
+			body: `{"timestamp":"1709294400000"}`,
+			want: models.Metadata{FileName: key, Timestamp: timestamp},
+		},
+		{
+			name: "unknown fields are kept",
+			body: `{"region":"eu","replicas":3,"build":{"commit":"abc"},"note":null}`,
+			want: models.Metadata{FileName: key, Extra: map[string]interface{}{
+				"region": "eu", "replicas": float64(3), "build": map[string]interface{}{"commit": "abc"},
+			}},
+		},
+		{
+			name: "values of the wrong type are left unset",
+			body: `{"slot":"soon","timestamp":true,"status":"ok"}`,
+			want: models.Metadata{FileName: key, Status: "ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMetadata(key, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseMetadata() error = %v", err)
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) || !got.UploadedAt.Equal(tt.want.UploadedAt) {
+				t.Errorf("parseMetadata() times = %v, %v, want %v, %v", got.Timestamp, got.UploadedAt, tt.want.Timestamp, tt.want.UploadedAt)
+			}
+			got.Timestamp, got.UploadedAt = tt.want.Timestamp, tt.want.UploadedAt
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseMetadata(key, []byte(`[1, 2]`)); !errors.Is(err, errInvalidMetadata) {
+		t.Errorf("parseMetadata() of an array error = %v, want %v", err, errInvalidMetadata)
+	}
+}
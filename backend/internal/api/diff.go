@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// MetadataDiff compares the metadata of two artifacts. Fields compares the
+// catalog entries and Raw the top-level fields of the metadata files, which
+// include the ones the catalog does not extract. Deltas are b minus a.
+type MetadataDiff struct {
+	A         string      `json:"a"`
+	B         string      `json:"b"`
+	Fields    []FieldDiff `json:"fields"`
+	Raw       []FieldDiff `json:"raw"`
+	SlotDelta int64       `json:"slot_delta"`
+	// TimeDeltaSeconds is unset if the time of either artifact is unknown
+	TimeDeltaSeconds *float64 `json:"time_delta_seconds,omitempty"`
+	// SizeDelta compares the artifacts' archives, or their metadata files
+	// if either archive is not listed
+	SizeDelta int64 `json:"size_delta"`
+}
+
+// FieldDiff compares one field of two documents. A value is left out if the
+// field is missing from that document.
+type FieldDiff struct {
+	Field string          `json:"field"`
+	A     json.RawMessage `json:"a,omitempty"`
+	B     json.RawMessage `json:"b,omitempty"`
+	Equal bool            `json:"equal"`
+}
+
+// diffFields compares two JSON objects field by field, ordered by field name
+func diffFields(a, b map[string]json.RawMessage) []FieldDiff {
+	fields := make(map[string]bool, len(a)+len(b))
+	for field := range a {
+		fields[field] = true
+	}
+	for field := range b {
+		fields[field] = true
+	}
+
+	diffs := make([]FieldDiff, 0, len(fields))
+	for field := range fields {
+		valueA, okA := a[field]
+		valueB, okB := b[field]
+		diffs = append(diffs, FieldDiff{
+			Field: field,
+			A:     valueA,
+			B:     valueB,
+			Equal: okA == okB && jsonEqual(valueA, valueB),
+		})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs
+}
+
+// jsonEqual reports whether two JSON values are equal regardless of object
+// key order and whitespace
+func jsonEqual(a, b json.RawMessage) bool {
+	var valueA, valueB interface{}
+	if json.Unmarshal(a, &valueA) != nil || json.Unmarshal(b, &valueB) != nil {
+		return bytes.Equal(a, b)
+	}
+	normalA, errA := json.Marshal(valueA)
+	normalB, errB := json.Marshal(valueB)
+	return errA == nil && errB == nil && bytes.Equal(normalA, normalB)
+}
+
+// jsonFields splits a JSON object into its top-level fields
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// lookupMetadata returns the catalog entry of an artifact by the key of its
+// entry or of any of its files
+func (h *Handler) lookupMetadata(source *Source, key string) (models.Metadata, bool) {
+	if metadata, ok := source.catalog.Get(key); ok {
+		return metadata, true
+	}
+	if match, ok := h.registry.Match(key); ok && match.MetadataKey != "" {
+		return source.catalog.Get(match.MetadataKey)
+	}
+	return models.Metadata{}, false
+}
+
+// rawMetadata fetches the top-level fields of an entry's metadata file. An
+// entry built from an artifact's name alone has none.
+func (h *Handler) rawMetadata(ctx context.Context, source *Source, metadata models.Metadata) (map[string]json.RawMessage, error) {
+	if !h.registry.IsMetadataFile(metadata.FileName) {
+		return map[string]json.RawMessage{}, nil
+	}
+
+	result, err := source.store.GetObject(ctx, metadata.FileName)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(result.Body)
+	result.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON object: %w", metadata.FileName, err)
+	}
+	return fields, nil
+}
+
+// DiffMetadata compares the metadata of the artifacts given by the a and b
+// parameters field by field
+func (h *Handler) DiffMetadata(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	keyA, keyB := r.URL.Query().Get("a"), r.URL.Query().Get("b")
+	if keyA == "" || keyB == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing a or b parameter")
+		return
+	}
+
+	log.Printf("DiffMetadata: Comparing %s and %s of source %s", keyA, keyB, source.Name)
+
+	metadata := make([]models.Metadata, 2)
+	raw := make([]map[string]json.RawMessage, 2)
+	fields := make([]map[string]json.RawMessage, 2)
+	for i, key := range []string{keyA, keyB} {
+		var ok bool
+		metadata[i], ok = h.lookupMetadata(source, key)
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Metadata not found: "+key)
+			return
+		}
+
+		var err error
+		raw[i], err = h.rawMetadata(r.Context(), source, metadata[i])
+		if err != nil {
+			log.Printf("DiffMetadata: Failed to read metadata file of %s: %v", key, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to read metadata file: "+err.Error())
+			return
+		}
+
+		fields[i], err = jsonFields(metadata[i])
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to encode metadata: "+err.Error())
+			return
+		}
+	}
+
+	diff := MetadataDiff{
+		A:         metadata[0].FileName,
+		B:         metadata[1].FileName,
+		Fields:    diffFields(fields[0], fields[1]),
+		Raw:       diffFields(raw[0], raw[1]),
+		SlotDelta: metadata[1].Slot - metadata[0].Slot,
+		SizeDelta: metadata[1].FileSize - metadata[0].FileSize,
+	}
+
+	artifacts := make(map[string]ArtifactObject)
+	for _, a := range source.catalog.Artifacts() {
+		artifacts[a.Metadata.FileName] = a
+	}
+	artifactA, okA := artifacts[metadata[0].FileName]
+	artifactB, okB := artifacts[metadata[1].FileName]
+	if okA && okB {
+		diff.SizeDelta = artifactB.Object.Size - artifactA.Object.Size
+	}
+
+	times := objectTimes(source.catalog.Objects())
+	timeA, timeB := metadataTime(metadata[0], times), metadataTime(metadata[1], times)
+	if !timeA.IsZero() && !timeB.IsZero() {
+		seconds := timeB.Sub(timeA).Seconds()
+		diff.TimeDeltaSeconds = &seconds
+	}
+
+	respondWithJSON(w, http.StatusOK, diff)
+}
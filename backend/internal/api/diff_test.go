@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDiffMetadata(t *testing.T) {
+	keyA := "snapshot-100-" + testNode
+	keyB := "snapshot-200-" + testNode
+	router := newMetadataRouter(t, map[string]string{
+		keyA + ".json":    `{"solana_version":"1.18.1","region":"eu","build":{"commit":"abc","dirty":false}}`,
+		keyA + ".tar.zst": "aaaa",
+		keyB + ".json":    `{"solana_version":"1.18.2","build":{"dirty":false,"commit":"abc"}}`,
+		keyB + ".tar.zst": "bbbbbbbbbb",
+	})
+
+	// The archive key resolves to the entry of its metadata file
+	path := "/api/metadata/diff?a=" + url.QueryEscape(keyA+".tar.zst") + "&b=" + url.QueryEscape(keyB+".json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s code = %d, want %d: %s", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var diff MetadataDiff
+	if err := json.Unmarshal(rec.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if diff.A != keyA+".json" || diff.B != keyB+".json" {
+		t.Errorf("diff compares %s and %s", diff.A, diff.B)
+	}
+	if diff.SlotDelta != 100 || diff.SizeDelta != 6 {
+		t.Errorf("slot delta = %d, size delta = %d, want 100 and 6", diff.SlotDelta, diff.SizeDelta)
+	}
+	if diff.TimeDeltaSeconds == nil {
+		t.Errorf("time delta is missing")
+	}
+
+	raw := make(map[string]FieldDiff)
+	for _, field := range diff.Raw {
+		raw[field.Field] = field
+	}
+	if len(raw) != 3 {
+		t.Errorf("raw fields = %+v, want build, region and solana_version", diff.Raw)
+	}
+	if !raw["build"].Equal {
+		t.Errorf("build = %+v, want equal regardless of key order", raw["build"])
+	}
+	if region := raw["region"]; region.Equal || string(region.A) != `"eu"` || region.B != nil {
+		t.Errorf("region = %+v, want only in a", region)
+	}
+	if raw["solana_version"].Equal {
+		t.Errorf("solana_version = %+v, want different", raw["solana_version"])
+	}
+
+	for _, field := range diff.Fields {
+		if field.Field == "slot" && field.Equal {
+			t.Errorf("catalog field slot = %+v, want different", field)
+		}
+	}
+
+	tests := map[string]int{
+		"/api/metadata/diff?a=" + url.QueryEscape(keyA+".json"):                http.StatusBadRequest,
+		"/api/metadata/diff?a=" + url.QueryEscape(keyA+".json") + "&b=missing": http.StatusNotFound,
+	}
+	for path, wantCode := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != wantCode {
+			t.Errorf("GET %s code = %d, want %d", path, rec.Code, wantCode)
+		}
+	}
+}
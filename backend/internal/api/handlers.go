@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -10,12 +11,16 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/blockdaemon/s3-bucket-browser/internal/artifact"
 	"github.com/blockdaemon/s3-bucket-browser/internal/cache"
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/index"
 	"github.com/blockdaemon/s3-bucket-browser/internal/models"
-	"github.com/blockdaemon/s3-bucket-browser/internal/s3"
+	"github.com/blockdaemon/s3-bucket-browser/internal/query"
+	"github.com/blockdaemon/s3-bucket-browser/internal/schema"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
 	"github.com/gorilla/mux"
 )
 
@@ -26,84 +31,177 @@ const (
 	metadataOptionsKey = "metadata:options"
 )
 
-// Regular expression to match snapshot JSON files
-var snapshotRegex = regexp.MustCompile(`snapshot-(\d+)-([A-Za-z0-9]+)\.json$`)
-
 // FilterOptions represents the available filter options
 type FilterOptions struct {
-	SolanaVersions []string `json:"solanaVersions"`
-	Statuses       []string `json:"statuses"`
-	UploadedBy     []string `json:"uploadedBy"`
-	Nodes          []string `json:"nodes"`
-	SlotRanges     []string `json:"slotRanges"`
+	SolanaVersions []string    `json:"solanaVersions"`
+	FeatureSets    []int       `json:"solanaFeatureSets"`
+	Statuses       []string    `json:"statuses"`
+	UploadedBy     []string    `json:"uploadedBy"`
+	Nodes          []string    `json:"nodes"`
+	SlotRanges     []string    `json:"slotRanges"`
+	SnapshotTypes  []string    `json:"snapshotTypes"`
+	ArtifactTypes  []string    `json:"artifactTypes"`
+	Counts         FacetCounts `json:"counts"`
+}
+
+// FacetCounts holds the number of metadata entries for each filter option
+type FacetCounts struct {
+	SolanaVersions map[string]int `json:"solanaVersions"`
+	FeatureSets    map[string]int `json:"solanaFeatureSets"`
+	Statuses       map[string]int `json:"statuses"`
+	UploadedBy     map[string]int `json:"uploadedBy"`
+	Nodes          map[string]int `json:"nodes"`
+	SlotRanges     map[string]int `json:"slotRanges"`
+	SnapshotTypes  map[string]int `json:"snapshotTypes"`
+	ArtifactTypes  map[string]int `json:"artifactTypes"`
+}
+
+// metadataFilterParams are the query parameters that filter metadata
+var metadataFilterParams = []string{
+	"q", "solanaVersion", "solanaFeatureSet", "status", "uploadedBy", "node", "slotRange",
+	"snapshotType", "artifactType", "baseSlot", "searchTerm", "minSlot", "maxSlot",
+	"startTime", "endTime",
+}
+
+// extraFilterPrefix prefixes the query parameters that filter metadata by an
+// extra field, as in extra.region=eu
+const extraFilterPrefix = "extra."
+
+// Breadcrumb represents one level of the path to a browsed prefix
+type Breadcrumb struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+}
+
+// Folder represents a common prefix below a browsed prefix
+type Folder struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+}
+
+// BrowseResult represents one folder-style level of the bucket
+type BrowseResult struct {
+	Prefix      string           `json:"prefix"`
+	Parent      string           `json:"parent"`
+	Breadcrumbs []Breadcrumb     `json:"breadcrumbs"`
+	Folders     []Folder         `json:"folders"`
+	Objects     []storage.Object `json:"objects"`
+	// Truncated is set if the listing stopped at the configured object cap
+	Truncated bool `json:"truncated"`
 }
 
 // Handler represents the API handler
 type Handler struct {
-	s3Service     *s3.Service
-	cacheService  *cache.RedisCache
-	hub           *Hub
-	filterOptions *FilterOptions
-	optionsLock   sync.RWMutex
+	sources           []*Source
+	sourcesByName     map[string]*Source
+	cacheService      *cache.RedisCache
+	catalogIndex      *index.DB
+	downloadPatterns  []*regexp.Regexp
+	downloadExpiry    time.Duration
+	maxDownloadExpiry time.Duration
+	registry          *artifact.Registry
+	staleSlots        int64
+	staleAfter        time.Duration
 }
 
-// NewHandler creates a new API handler
-func NewHandler(s3Service *s3.Service, cacheService *cache.RedisCache) *Handler {
-	hub := NewHub(s3Service)
+// NewHandler creates a new API handler serving the given sources. The first
+// source is the default for routes that do not name one. If catalogIndex is
+// set, catalogs are restored from it and kept in it.
+func NewHandler(sources []*Source, cacheService *cache.RedisCache, catalogIndex *index.DB, cfg *config.Config) *Handler {
+	// Patterns are validated when the config is loaded
+	downloadPatterns := make([]*regexp.Regexp, 0, len(cfg.Download.AllowedPatterns))
+	for _, pattern := range cfg.Download.AllowedPatterns {
+		downloadPatterns = append(downloadPatterns, regexp.MustCompile(pattern))
+	}
+
+	// Artifact types are validated when the config is loaded
+	registry := artifact.DefaultRegistry()
+	if len(cfg.Artifacts) > 0 {
+		registry = artifact.MustNewRegistry(cfg.Artifacts)
+	}
+
+	// The schema is validated when the config is loaded
+	validator := schema.MustLoad(cfg.Validation.SchemaFile)
 
 	handler := &Handler{
-		s3Service:    s3Service,
-		cacheService: cacheService,
-		hub:          hub,
-		filterOptions: &FilterOptions{
-			SolanaVersions: []string{},
-			Statuses:       []string{},
-			UploadedBy:     []string{},
-			Nodes:          []string{},
-			SlotRanges:     []string{},
-		},
-		optionsLock: sync.RWMutex{},
+		sources:           sources,
+		sourcesByName:     make(map[string]*Source, len(sources)),
+		cacheService:      cacheService,
+		catalogIndex:      catalogIndex,
+		downloadPatterns:  downloadPatterns,
+		downloadExpiry:    time.Duration(cfg.Download.URLExpirySeconds) * time.Second,
+		maxDownloadExpiry: time.Duration(cfg.Download.MaxURLExpirySeconds) * time.Second,
+		registry:          registry,
+		staleSlots:        cfg.Analysis.StaleSlots,
+		staleAfter:        time.Duration(cfg.Analysis.StaleAfterSeconds) * time.Second,
 	}
 
-	// Start the WebSocket hub
-	go hub.Run(context.Background())
+	for _, source := range sources {
+		handler.sourcesByName[source.Name] = source
+		source.catalog.registry = registry
+		source.catalog.schema = validator
+
+		// Serve the catalog from the index while it is synced in the background
+		if catalogIndex != nil {
+			handler.restoreCatalog(source)
+		}
+
+		// Start the WebSocket hub
+		go source.hub.Run(context.Background())
 
-	// Start initial metadata indexing
-	go handler.indexMetadata(context.Background())
+		// Index the source and keep its catalog up to date
+		go handler.watchSource(context.Background(), source)
+	}
 
 	return handler
 }
 
 // RegisterRoutes registers the API routes
 func (h *Handler) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/api/files", h.ListFiles).Methods("GET")
-	r.HandleFunc("/api/files/{key}", h.GetFile).Methods("GET")
-	r.HandleFunc("/api/metadata/options", h.GetMetadataOptions).Methods("GET")
-	r.HandleFunc("/api/metadata", h.ListMetadata).Methods("GET")
-	r.HandleFunc("/api/metadata/{key}", h.GetMetadata).Methods("GET")
-	r.HandleFunc("/api/ws", h.WebSocketHandler).Methods("GET")
-	r.HandleFunc("/api/debug/reindex", h.DebugReindex).Methods("GET")
-	r.HandleFunc("/api/debug/examine-file", h.DebugExamineFile).Methods("GET")
-}
+	r.HandleFunc("/api/sources", h.ListSources).Methods("GET")
 
-// isSnapshotMetadataFile checks if a file is a snapshot metadata file
-func isSnapshotMetadataFile(key string) bool {
-	return snapshotRegex.MatchString(key)
-}
+	// Routes scoped to a named source
+	h.registerSourceRoutes(r.PathPrefix("/api/sources/{source}").Subrouter())
 
-// extractSlotAndNode extracts the slot and node from a snapshot metadata file name
-func extractSlotAndNode(key string) (int64, string) {
-	matches := snapshotRegex.FindStringSubmatch(key)
-	if len(matches) < 3 {
-		return 0, ""
-	}
+	// Unscoped routes are served by the default source
+	h.registerSourceRoutes(r.PathPrefix("/api").Subrouter())
 
-	slot, err := strconv.ParseInt(matches[1], 10, 64)
-	if err != nil {
-		return 0, ""
-	}
+	// Snapshot downloads at the paths validators fetch from RPC nodes
+	h.registerSnapshotRoutes(r.PathPrefix("/sources/{source}").Subrouter())
+	h.registerSnapshotRoutes(r)
+}
 
-	return slot, matches[2]
+// registerSourceRoutes registers the routes that operate on a single source
+func (h *Handler) registerSourceRoutes(r *mux.Router) {
+	r.HandleFunc("/files", h.ListFiles).Methods("GET")
+	r.HandleFunc("/files/{key}", h.GetFile).Methods("GET")
+	r.HandleFunc("/browse", h.Browse).Methods("GET")
+	r.HandleFunc("/download", h.Download).Methods("GET")
+	r.HandleFunc("/metadata/options", h.GetMetadataOptions).Methods("GET")
+	r.HandleFunc("/metadata", h.ListMetadata).Methods("GET")
+	r.HandleFunc("/metadata/diff", h.DiffMetadata).Methods("GET")
+	r.HandleFunc("/metadata/{key}", h.GetMetadata).Methods("GET")
+	r.HandleFunc("/snapshots/latest", h.LatestSnapshot).Methods("GET")
+	r.HandleFunc("/analysis/cadence", h.GetCadence).Methods("GET")
+	r.HandleFunc("/analysis/compatibility", h.GetCompatibility).Methods("GET")
+	r.HandleFunc("/analysis/consensus", h.GetConsensus).Methods("GET")
+	r.HandleFunc("/analysis/pairing", h.GetPairing).Methods("GET")
+	r.HandleFunc("/stats", h.GetStats).Methods("GET")
+	r.HandleFunc("/index/problems", h.GetIndexProblems).Methods("GET")
+	r.HandleFunc("/verify/{key:.+}", h.VerifyObject).Methods("POST")
+	r.HandleFunc("/archive/{key:.+}/entries", h.ListArchiveEntries).Methods("GET")
+	r.HandleFunc("/ws", h.WebSocketHandler).Methods("GET")
+	r.HandleFunc("/debug/reindex", h.DebugReindex).Methods("GET")
+	r.HandleFunc("/debug/examine-file", h.DebugExamineFile).Methods("GET")
+}
+
+// registerSnapshotRoutes registers the snapshot redirects, both for every
+// node and for a single node
+func (h *Handler) registerSnapshotRoutes(r *mux.Router) {
+	r.HandleFunc("/snapshot.tar.bz2", h.RedirectSnapshot).Methods("GET", "HEAD")
+	r.HandleFunc("/incremental-snapshot.tar.bz2", h.RedirectIncrementalSnapshot).Methods("GET", "HEAD")
+	r.HandleFunc("/nodes/{node}/snapshot.tar.bz2", h.RedirectSnapshot).Methods("GET", "HEAD")
+	r.HandleFunc("/nodes/{node}/incremental-snapshot.tar.bz2", h.RedirectIncrementalSnapshot).Methods("GET", "HEAD")
 }
 
 // getSlotRange returns a human-readable slot range
@@ -120,209 +218,134 @@ func getSlotRange(slot int64) string {
 	return strconv.FormatInt(rangeStart/1000000, 10) + "M-" + strconv.FormatInt(rangeEnd/1000000, 10) + "M"
 }
 
-// Define a simplified metadata struct for parsing that doesn't use time.Time
-type SimpleMetadata struct {
-	SolanaVersion string `json:"solana_version"`
-	Status        string `json:"status"`
-	UploadedBy    string `json:"uploaded_by"`
+// emptyFilterOptions returns filter options without any values
+func emptyFilterOptions() *FilterOptions {
+	return &FilterOptions{
+		SolanaVersions: []string{},
+		FeatureSets:    []int{},
+		Statuses:       []string{},
+		UploadedBy:     []string{},
+		Nodes:          []string{},
+		SlotRanges:     []string{},
+		SnapshotTypes:  []string{},
+		ArtifactTypes:  []string{},
+		Counts: FacetCounts{
+			SolanaVersions: map[string]int{},
+			FeatureSets:    map[string]int{},
+			Statuses:       map[string]int{},
+			UploadedBy:     map[string]int{},
+			Nodes:          map[string]int{},
+			SlotRanges:     map[string]int{},
+			SnapshotTypes:  map[string]int{},
+			ArtifactTypes:  map[string]int{},
+		},
+	}
 }
 
-// indexMetadata indexes all metadata files to build filter options
-func (h *Handler) indexMetadata(ctx context.Context) {
-	log.Println("Starting initial metadata indexing...")
+// indexMetadata syncs the catalog of a source with its store and rebuilds
+// the filter options if any metadata changed
+func (h *Handler) indexMetadata(ctx context.Context, source *Source) {
+	firstSync := source.catalog.SyncedAt().IsZero()
+	if firstSync {
+		log.Printf("Starting initial metadata indexing of source %s...", source.Name)
 
-	// Try to get from cache first
-	if h.cacheService != nil {
-		var options FilterOptions
-		err := h.cacheService.Get(ctx, metadataOptionsKey, &options)
-		if err == nil {
-			// Cache hit, use cached options
-			h.optionsLock.Lock()
-			h.filterOptions = &options
-			h.optionsLock.Unlock()
-			log.Println("Loaded filter options from cache")
-			return
-		} else {
-			log.Printf("Cache miss for metadata options: %v", err)
+		// Serve cached filter options until the first sync completes
+		if h.cacheService != nil {
+			var options FilterOptions
+			err := h.cacheService.Get(ctx, source.cacheKey(), &options)
+			if err == nil {
+				source.optionsLock.Lock()
+				source.filterOptions = &options
+				source.optionsLock.Unlock()
+				log.Printf("Loaded filter options of source %s from cache", source.Name)
+			} else {
+				log.Printf("Cache miss for metadata options of source %s: %v", source.Name, err)
+			}
 		}
-	} else {
-		log.Println("Cache service not available, skipping cache operations")
 	}
 
-	// List all objects
-	objects, err := h.s3Service.ListObjects(ctx, "")
-	if err != nil {
-		log.Printf("Failed to list objects for indexing: %v", err)
+	// A partial listing still yields useful metadata, so only bail out when
+	// nothing could be listed at all
+	result, err := source.catalog.Sync(ctx, source.store)
+	if result == nil {
+		log.Printf("Failed to list objects of source %s for indexing: %v", source.Name, err)
 		return
+	} else if err != nil {
+		log.Printf("Indexing a partial listing of source %s: %v", source.Name, err)
 	}
 
-	log.Printf("Found %d total objects in S3 bucket", len(objects))
+	if result.MetadataChanged() || result.Failed > 0 {
+		log.Printf("Indexed source %s: %d objects, %d metadata files added, %d updated, %d removed, %d failed",
+			source.Name, result.Objects, result.Added, result.Updated, result.Removed, result.Failed)
+	}
 
-	// Filter metadata files
-	var metadataFiles []s3.Object
-	for _, obj := range objects {
-		if obj.IsMetadata && isSnapshotMetadataFile(obj.Key) {
-			metadataFiles = append(metadataFiles, obj)
-		}
+	if result.ListingChanged {
+		source.hub.Publish(source.catalog.Objects())
+	}
+
+	if !firstSync && !result.MetadataChanged() {
+		return
 	}
 
-	log.Printf("Found %d snapshot metadata files to index", len(metadataFiles))
+	h.checkConsensus(source)
+
+	options := buildFilterOptions(source.catalog.Metadata())
 
-	if len(metadataFiles) == 0 {
-		log.Println("No metadata files found to index. Check S3 bucket and file naming patterns.")
-		// Set empty options to avoid repeated indexing attempts
-		h.optionsLock.Lock()
-		h.filterOptions = &FilterOptions{
-			SolanaVersions: []string{},
-			Statuses:       []string{},
-			UploadedBy:     []string{},
-			Nodes:          []string{},
-			SlotRanges:     []string{},
+	source.optionsLock.Lock()
+	source.filterOptions = options
+	source.optionsLock.Unlock()
+
+	if h.cacheService != nil {
+		if err := h.cacheService.Set(ctx, source.cacheKey(), options, cacheExpiration); err != nil {
+			log.Printf("Failed to cache filter options of source %s: %v", source.Name, err)
 		}
-		h.optionsLock.Unlock()
-		return
 	}
 
-	// Log some sample file names for debugging
-	if len(metadataFiles) > 0 {
-		sampleSize := 5
-		if len(metadataFiles) < sampleSize {
-			sampleSize = len(metadataFiles)
+	log.Printf("Metadata indexing of source %s complete. Found %d versions, %d statuses, %d uploaders, %d nodes, %d slot ranges",
+		source.Name, len(options.SolanaVersions), len(options.Statuses), len(options.UploadedBy), len(options.Nodes), len(options.SlotRanges))
+}
+
+// buildFilterOptions collects the distinct filter values of the given metadata
+func buildFilterOptions(metadataList []models.Metadata) *FilterOptions {
+	versions := make(map[string]int)
+	featureSets := make(map[int]int)
+	statuses := make(map[string]int)
+	uploaders := make(map[string]int)
+	nodes := make(map[string]int)
+	slotRanges := make(map[string]int)
+	snapshotTypes := make(map[string]int)
+	artifactTypes := make(map[string]int)
+
+	for _, metadata := range metadataList {
+		if metadata.Slot > 0 && metadata.Node != "" {
+			nodes[metadata.Node]++
+			slotRanges[getSlotRange(metadata.Slot)]++
 		}
-		log.Printf("Sample metadata files: %v", metadataFiles[:sampleSize])
-
-		// Examine the first file in detail
-		if len(metadataFiles) > 0 {
-			firstFile := metadataFiles[0]
-			result, err := h.s3Service.GetObject(ctx, firstFile.Key)
-			if err != nil {
-				log.Printf("Failed to get first metadata file %s: %v", firstFile.Key, err)
-			} else {
-				body, err := io.ReadAll(result.Body)
-				result.Body.Close()
-				if err != nil {
-					log.Printf("Failed to read first metadata file %s: %v", firstFile.Key, err)
-				} else {
-					log.Printf("Content of first metadata file %s: %s", firstFile.Key, string(body))
-
-					// Try to parse as JSON
-					var rawData map[string]interface{}
-					if err := json.Unmarshal(body, &rawData); err != nil {
-						log.Printf("Failed to parse first metadata file as JSON: %v", err)
-					} else {
-						log.Printf("First metadata file parsed as JSON: %v", rawData)
-					}
-				}
-			}
+
+		if metadata.SolanaVersion != "" && metadata.SolanaVersion != "unknown" {
+			versions[metadata.SolanaVersion]++
 		}
-	}
 
-	// Process metadata files
-	versions := make(map[string]bool)
-	statuses := make(map[string]bool)
-	uploaders := make(map[string]bool)
-	nodes := make(map[string]bool)
-	slotRanges := make(map[string]bool)
-
-	// Use a worker pool to process files in parallel
-	workerCount := 10
-	filesChan := make(chan s3.Object, len(metadataFiles))
-	var wg sync.WaitGroup
-
-	// Mutex for concurrent map access
-	var mapMutex sync.Mutex
-
-	// Start workers
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			for obj := range filesChan {
-				// Extract slot and node from filename
-				slot, node := extractSlotAndNode(obj.Key)
-				if slot > 0 && node != "" {
-					mapMutex.Lock()
-					nodes[node] = true
-					slotRange := getSlotRange(slot)
-					slotRanges[slotRange] = true
-					mapMutex.Unlock()
-				}
-
-				// Get metadata from S3
-				result, err := h.s3Service.GetObject(ctx, obj.Key)
-				if err != nil {
-					log.Printf("Failed to get metadata file %s: %v", obj.Key, err)
-					continue
-				}
-
-				// Parse metadata
-				body, err := io.ReadAll(result.Body)
-				result.Body.Close()
-
-				if err != nil {
-					log.Printf("Failed to read metadata file %s: %v", obj.Key, err)
-					continue
-				}
-
-				// Try to parse with the simplified struct first
-				var simpleMetadata SimpleMetadata
-				err = json.Unmarshal(body, &simpleMetadata)
-				if err != nil {
-					log.Printf("Failed to parse metadata file %s: %v", obj.Key, err)
-
-					// Try to parse as a generic map as a fallback
-					var rawData map[string]interface{}
-					if jsonErr := json.Unmarshal(body, &rawData); jsonErr == nil {
-						// Extract fields from the raw data
-						mapMutex.Lock()
-						if version, ok := rawData["solana_version"].(string); ok && version != "" && version != "unknown" {
-							versions[version] = true
-						}
-						if status, ok := rawData["status"].(string); ok && status != "" && status != "unknown" {
-							statuses[status] = true
-						}
-						if uploader, ok := rawData["uploaded_by"].(string); ok && uploader != "" && uploader != "unknown" {
-							uploaders[uploader] = true
-						}
-						mapMutex.Unlock()
-					}
-					continue
-				}
-
-				// Add to unique sets
-				mapMutex.Lock()
-				if simpleMetadata.SolanaVersion != "" && simpleMetadata.SolanaVersion != "unknown" {
-					versions[simpleMetadata.SolanaVersion] = true
-				}
-
-				if simpleMetadata.Status != "" && simpleMetadata.Status != "unknown" {
-					statuses[simpleMetadata.Status] = true
-				}
-
-				if simpleMetadata.UploadedBy != "" && simpleMetadata.UploadedBy != "unknown" {
-					uploaders[simpleMetadata.UploadedBy] = true
-				}
-				mapMutex.Unlock()
-			}
-		}()
-	}
+		if metadata.SolanaFeatureSet != 0 {
+			featureSets[metadata.SolanaFeatureSet]++
+		}
 
-	// Send files to workers
-	for _, file := range metadataFiles {
-		filesChan <- file
-	}
-	close(filesChan)
+		if metadata.Status != "" && metadata.Status != "unknown" {
+			statuses[metadata.Status]++
+		}
 
-	// Wait for all workers to finish
-	wg.Wait()
+		if metadata.UploadedBy != "" && metadata.UploadedBy != "unknown" {
+			uploaders[metadata.UploadedBy]++
+		}
+
+		if metadata.SnapshotType != "" {
+			snapshotTypes[metadata.SnapshotType]++
+		}
 
-	// Log the raw data collected
-	log.Printf("Raw versions collected: %v", versions)
-	log.Printf("Raw statuses collected: %v", statuses)
-	log.Printf("Raw uploaders collected: %v", uploaders)
-	log.Printf("Raw nodes collected: %v", nodes)
-	log.Printf("Raw slot ranges collected: %v", slotRanges)
+		if metadata.ArtifactType != "" {
+			artifactTypes[metadata.ArtifactType]++
+		}
+	}
 
 	// Convert maps to slices
 	versionsList := make([]string, 0, len(versions))
@@ -332,41 +355,17 @@ func (h *Handler) indexMetadata(ctx context.Context) {
 
 	// Sort versions semantically
 	sort.Slice(versionsList, func(i, j int) bool {
-		// Extract major, minor, patch versions
-		vI := strings.Split(versionsList[i], ".")
-		vJ := strings.Split(versionsList[j], ".")
-
-		// Compare major version
-		if len(vI) > 0 && len(vJ) > 0 {
-			majorI, errI := strconv.Atoi(vI[0])
-			majorJ, errJ := strconv.Atoi(vJ[0])
-			if errI == nil && errJ == nil && majorI != majorJ {
-				return majorI < majorJ
-			}
-		}
-
-		// Compare minor version
-		if len(vI) > 1 && len(vJ) > 1 {
-			minorI, errI := strconv.Atoi(vI[1])
-			minorJ, errJ := strconv.Atoi(vJ[1])
-			if errI == nil && errJ == nil && minorI != minorJ {
-				return minorI < minorJ
-			}
-		}
-
-		// Compare patch version
-		if len(vI) > 2 && len(vJ) > 2 {
-			patchI, errI := strconv.Atoi(vI[2])
-			patchJ, errJ := strconv.Atoi(vJ[2])
-			if errI == nil && errJ == nil {
-				return patchI < patchJ
-			}
-		}
-
-		// Fallback to string comparison
-		return versionsList[i] < versionsList[j]
+		return models.CompareVersions(versionsList[i], versionsList[j]) < 0
 	})
 
+	featureSetsList := make([]int, 0, len(featureSets))
+	featureSetCounts := make(map[string]int, len(featureSets))
+	for f, count := range featureSets {
+		featureSetsList = append(featureSetsList, f)
+		featureSetCounts[strconv.Itoa(f)] = count
+	}
+	sort.Ints(featureSetsList)
+
 	statusesList := make([]string, 0, len(statuses))
 	for s := range statuses {
 		statusesList = append(statusesList, s)
@@ -418,17 +417,38 @@ func (h *Handler) indexMetadata(ctx context.Context) {
 		return aNum < bNum
 	})
 
-	// Update filter options
-	h.optionsLock.Lock()
-	h.filterOptions.SolanaVersions = versionsList
-	h.filterOptions.Statuses = statusesList
-	h.filterOptions.UploadedBy = uploadersList
-	h.filterOptions.Nodes = nodesList
-	h.filterOptions.SlotRanges = slotRangesList
-	h.optionsLock.Unlock()
-
-	log.Printf("Metadata indexing complete. Found %d versions, %d statuses, %d uploaders, %d nodes, %d slot ranges",
-		len(versionsList), len(statusesList), len(uploadersList), len(nodesList), len(slotRangesList))
+	snapshotTypesList := make([]string, 0, len(snapshotTypes))
+	for t := range snapshotTypes {
+		snapshotTypesList = append(snapshotTypesList, t)
+	}
+	sort.Strings(snapshotTypesList)
+
+	artifactTypesList := make([]string, 0, len(artifactTypes))
+	for t := range artifactTypes {
+		artifactTypesList = append(artifactTypesList, t)
+	}
+	sort.Strings(artifactTypesList)
+
+	return &FilterOptions{
+		SolanaVersions: versionsList,
+		FeatureSets:    featureSetsList,
+		Statuses:       statusesList,
+		UploadedBy:     uploadersList,
+		Nodes:          nodesList,
+		SlotRanges:     slotRangesList,
+		SnapshotTypes:  snapshotTypesList,
+		ArtifactTypes:  artifactTypesList,
+		Counts: FacetCounts{
+			SolanaVersions: versions,
+			FeatureSets:    featureSetCounts,
+			Statuses:       statuses,
+			UploadedBy:     uploaders,
+			Nodes:          nodes,
+			SlotRanges:     slotRanges,
+			SnapshotTypes:  snapshotTypes,
+			ArtifactTypes:  artifactTypes,
+		},
+	}
 }
 
 // GetMetadataOptions returns the available filter options
@@ -440,52 +460,31 @@ func (h *Handler) GetMetadataOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
-	// Check if we have options in memory
-	h.optionsLock.RLock()
-	options := h.filterOptions
-	h.optionsLock.RUnlock()
-
-	// If we don't have options in memory, try to get from cache
-	if options == nil || len(options.SolanaVersions) == 0 && len(options.Statuses) == 0 {
-		log.Println("GetMetadataOptions: No options in memory, checking cache")
-
-		// Try to get from cache if available
-		if h.cacheService != nil {
-			var cachedOptions FilterOptions
-			err := h.cacheService.Get(r.Context(), metadataOptionsKey, &cachedOptions)
-			if err == nil {
-				log.Println("GetMetadataOptions: Using options from cache")
-				options = &cachedOptions
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
 
-				// Update in-memory options
-				h.optionsLock.Lock()
-				h.filterOptions = &cachedOptions
-				h.optionsLock.Unlock()
-			} else {
-				log.Printf("GetMetadataOptions: Cache miss: %v", err)
-			}
-		} else {
-			log.Println("GetMetadataOptions: Cache service not available")
+	// Facets of a filtered request reflect its result set
+	if hasMetadataFilter(r) {
+		metadataList, err := filterMetadata(r, source)
+		if err != nil {
+			log.Printf("GetMetadataOptions: Invalid query: %v", err)
+			respondWithQueryError(w, err)
+			return
 		}
+		respondWithJSON(w, http.StatusOK, buildFilterOptions(metadataList))
+		return
 	}
 
-	// If we still don't have options, trigger indexing
-	if options == nil || len(options.SolanaVersions) == 0 && len(options.Statuses) == 0 {
-		log.Println("GetMetadataOptions: No options available, triggering indexing")
-
-		// Create empty options to avoid nil pointer
-		options = &FilterOptions{
-			SolanaVersions: []string{},
-			Statuses:       []string{},
-			UploadedBy:     []string{},
-			Nodes:          []string{},
-			SlotRanges:     []string{},
-		}
+	// Check if we have options in memory
+	source.optionsLock.RLock()
+	options := source.filterOptions
+	source.optionsLock.RUnlock()
 
-		// Trigger indexing in a goroutine
-		go func() {
-			h.indexMetadata(context.Background())
-		}()
+	// Options are rebuilt from the catalog by the indexer
+	if options == nil {
+		options = emptyFilterOptions()
 	}
 
 	log.Printf("GetMetadataOptions: Returning options with %d versions, %d statuses, %d uploaders, %d nodes, %d slot ranges",
@@ -502,20 +501,149 @@ func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
-	log.Printf("ListFiles: Request received")
-
-	// List objects directly from S3 (skip cache for now since it's causing issues)
-	objects, err := h.s3Service.ListObjects(r.Context(), "")
-	if err != nil {
-		log.Printf("ListFiles: Failed to list objects: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to list objects")
+	source, ok := h.requestSource(w, r)
+	if !ok {
 		return
 	}
 
+	log.Printf("ListFiles: Request received for source %s", source.Name)
+
+	// Serve the catalog's listing once it has been synced, otherwise list the
+	// store directly. A partial listing is served with the partial flag set.
+	objects := source.catalog.Objects()
+	partial := source.catalog.Partial()
+	if source.catalog.SyncedAt().IsZero() {
+		var err error
+		objects, err = source.store.ListObjects(r.Context(), "")
+		var partialErr *storage.PartialListError
+		partial = errors.As(err, &partialErr)
+		if partial {
+			log.Printf("ListFiles: Serving a partial listing: %v", err)
+		} else if err != nil {
+			log.Printf("ListFiles: Failed to list objects: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to list objects: "+err.Error())
+			return
+		}
+	}
+
 	log.Printf("ListFiles: Found %d objects", len(objects))
 
+	// Classify the objects by artifact type, optionally keeping one type,
+	// without modifying the catalog's listing
+	artifactType := r.URL.Query().Get("type")
+	typed := make([]storage.Object, 0, len(objects))
+	for _, obj := range objects {
+		if match, ok := h.registry.Match(obj.Key); ok {
+			obj.ArtifactType = match.Type.Name
+		}
+		if artifactType != "" && obj.ArtifactType != artifactType {
+			continue
+		}
+		typed = append(typed, obj)
+	}
+	objects = typed
+
+	// Order by key
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	result, err := paginate(r, objects, "key:asc", func(a, b storage.Object) bool {
+		return a.Key < b.Key
+	}, func(obj storage.Object) storage.Object {
+		return storage.Object{Key: obj.Key}
+	})
+	if err != nil {
+		log.Printf("ListFiles: Invalid cursor: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result.Partial = partial
+
 	// Return the files
-	respondWithJSON(w, http.StatusOK, objects)
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// Browse lists a single folder-style level of the bucket
+func (h *Handler) Browse(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	prefix := normalizePrefix(r.URL.Query().Get("prefix"))
+
+	log.Printf("Browse: Request received for prefix %q of source %s", prefix, source.Name)
+
+	dir, err := source.store.ListDirectory(r.Context(), prefix)
+	truncated := errors.Is(err, storage.ErrListTruncated)
+	if err != nil && !truncated {
+		log.Printf("Browse: Failed to list prefix %q: %v", prefix, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list objects: "+err.Error())
+		return
+	}
+
+	folders := make([]Folder, 0, len(dir.Prefixes))
+	for _, p := range dir.Prefixes {
+		folders = append(folders, Folder{
+			Name:   strings.TrimSuffix(strings.TrimPrefix(p, prefix), storage.Delimiter),
+			Prefix: p,
+		})
+	}
+
+	result := BrowseResult{
+		Prefix:      prefix,
+		Parent:      parentPrefix(prefix),
+		Breadcrumbs: buildBreadcrumbs(prefix),
+		Folders:     folders,
+		Objects:     dir.Objects,
+		Truncated:   truncated,
+	}
+
+	log.Printf("Browse: Found %d folders and %d objects under %q", len(folders), len(dir.Objects), prefix)
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// normalizePrefix strips leading delimiters and makes sure a non-empty prefix
+// ends with the delimiter so it addresses a folder
+func normalizePrefix(prefix string) string {
+	prefix = strings.TrimLeft(prefix, storage.Delimiter)
+	if prefix != "" && !strings.HasSuffix(prefix, storage.Delimiter) {
+		prefix += storage.Delimiter
+	}
+	return prefix
+}
+
+// parentPrefix returns the prefix one level above the given prefix
+func parentPrefix(prefix string) string {
+	trimmed := strings.TrimSuffix(prefix, storage.Delimiter)
+	i := strings.LastIndex(trimmed, storage.Delimiter)
+	if i < 0 {
+		return ""
+	}
+	return trimmed[:i+1]
+}
+
+// buildBreadcrumbs returns the path from the bucket root to the given prefix
+func buildBreadcrumbs(prefix string) []Breadcrumb {
+	breadcrumbs := []Breadcrumb{{Name: "/", Prefix: ""}}
+
+	current := ""
+	for _, part := range strings.Split(strings.TrimSuffix(prefix, storage.Delimiter), storage.Delimiter) {
+		if part == "" {
+			continue
+		}
+		current += part + storage.Delimiter
+		breadcrumbs = append(breadcrumbs, Breadcrumb{Name: part, Prefix: current})
+	}
+
+	return breadcrumbs
 }
 
 // GetFile gets a file from the S3 bucket
@@ -524,23 +652,31 @@ func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 
-	// Check if it's a .tar.gz file
-	if s3.IsTarGzFile(key) {
-		respondWithError(w, http.StatusForbidden, "Downloading .tar.gz files is not allowed")
+	source, ok := h.requestSource(w, r)
+	if !ok {
 		return
 	}
 
-	// Get the file from S3
-	result, err := h.s3Service.GetObject(ctx, key)
-	if err != nil {
+	// Check if it's a snapshot archive
+	if storage.IsArchiveFile(key) {
+		respondWithError(w, http.StatusForbidden, "Downloading archives is not allowed, use /api/download for a presigned URL")
+		return
+	}
+
+	// Get the file from the store
+	result, err := source.store.GetObject(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Object not found")
+		return
+	} else if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to get object: "+err.Error())
 		return
 	}
 	defer result.Body.Close()
 
 	// Set the content type
-	w.Header().Set("Content-Type", *result.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(*result.ContentLength, 10))
+	w.Header().Set("Content-Type", result.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(result.ContentLength, 10))
 
 	// Copy the file to the response
 	_, err = io.Copy(w, result.Body)
@@ -550,182 +686,140 @@ func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// ListMetadata lists metadata for .tar.gz files
-func (h *Handler) ListMetadata(w http.ResponseWriter, r *http.Request) {
+// Download returns a short-lived presigned URL for downloading an object
+// directly from S3, or redirects to it when redirect=true
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
 	// Set CORS headers
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
-	log.Printf("ListMetadata: Request received with query: %s", r.URL.RawQuery)
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
 
-	// Parse filter and pagination parameters
-	filter := parseMetadataFilter(r)
-	page, pageSize := getPaginationParams(r)
+	query := r.URL.Query()
+	key := query.Get("key")
+	if key == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing key parameter")
+		return
+	}
 
-	// List objects from S3 directly (skip cache for now since it's causing issues)
-	objects, err := h.s3Service.ListObjects(r.Context(), "")
-	if err != nil {
-		log.Printf("ListMetadata: Error listing objects: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to list objects")
+	if !h.isDownloadAllowed(key) {
+		respondWithError(w, http.StatusForbidden, "Downloading this key is not allowed")
 		return
 	}
 
-	// Filter for metadata files
-	var metadataFiles []s3.Object
-	for _, obj := range objects {
-		if isSnapshotMetadataFile(obj.Key) {
-			metadataFiles = append(metadataFiles, obj)
+	expiry := h.downloadExpiry
+	if expires := query.Get("expires"); expires != "" {
+		seconds, err := strconv.Atoi(expires)
+		if err != nil || seconds <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid expires parameter")
+			return
+		}
+		expiry = time.Duration(seconds) * time.Second
+		if expiry > h.maxDownloadExpiry {
+			expiry = h.maxDownloadExpiry
 		}
 	}
 
-	log.Printf("ListMetadata: Found %d metadata files", len(metadataFiles))
+	presigner, ok := source.store.(storage.Presigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "The storage backend does not support download URLs")
+		return
+	}
 
-	// If no metadata files found, return empty list
-	if len(metadataFiles) == 0 {
-		log.Println("ListMetadata: No metadata files found in S3 bucket")
-		result := struct {
-			Items []models.Metadata `json:"items"`
-			Total int               `json:"total"`
-		}{
-			Items: []models.Metadata{},
-			Total: 0,
-		}
-		respondWithJSON(w, http.StatusOK, result)
+	filename := sanitizeFilename(query.Get("filename"))
+
+	presigned, err := presigner.PresignGetObject(r.Context(), key, expiry, filename)
+	if err != nil {
+		log.Printf("Download: Failed to presign %s: %v", key, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create download URL: "+err.Error())
 		return
 	}
 
-	// Process each metadata file
-	var metadataList []models.Metadata
-	for _, obj := range metadataFiles {
-		// Get metadata content
-		result, err := h.s3Service.GetObject(r.Context(), obj.Key)
-		if err != nil {
-			log.Printf("ListMetadata: Error getting object %s: %v", obj.Key, err)
-			continue
-		}
+	log.Printf("Download: Presigned %s for %s", key, expiry)
 
-		// Read the content
-		body, err := io.ReadAll(result.Body)
-		result.Body.Close()
-		if err != nil {
-			log.Printf("ListMetadata: Error reading object %s: %v", obj.Key, err)
-			continue
-		}
+	if redirect, _ := strconv.ParseBool(query.Get("redirect")); redirect {
+		http.Redirect(w, r, presigned.URL, http.StatusFound)
+		return
+	}
 
-		// Try to parse with the simplified struct first
-		var simpleMetadata SimpleMetadata
-		err = json.Unmarshal(body, &simpleMetadata)
-		if err != nil {
-			log.Printf("ListMetadata: Failed to parse simple metadata %s: %v", obj.Key, err)
-
-			// Try to parse as a generic map as a fallback
-			var rawData map[string]interface{}
-			if jsonErr := json.Unmarshal(body, &rawData); jsonErr == nil {
-				// Create a metadata object from the raw data
-				metadata := models.Metadata{
-					FileName: obj.Key,
-					FileSize: *result.ContentLength,
-				}
-
-				// Extract fields from the raw data
-				if version, ok := rawData["solana_version"].(string); ok {
-					metadata.SolanaVersion = version
-				}
-				if status, ok := rawData["status"].(string); ok {
-					metadata.Status = status
-				}
-				if uploader, ok := rawData["uploaded_by"].(string); ok {
-					metadata.UploadedBy = uploader
-				}
-				if slot, ok := rawData["slot"].(float64); ok {
-					metadata.Slot = int64(slot)
-				}
-				if hash, ok := rawData["hash"].(string); ok {
-					metadata.Hash = hash
-				}
-				if timestamp, ok := rawData["timestamp"].(float64); ok {
-					metadata.Timestamp = time.Unix(int64(timestamp), 0)
-				}
-
-				// Extract slot and node from filename if it's a snapshot file
-				if isSnapshotMetadataFile(obj.Key) {
-					slot, node := extractSlotAndNode(obj.Key)
-					if metadata.Slot == 0 && slot > 0 {
-						metadata.Slot = slot
-					}
-					if metadata.Node == "" && node != "" {
-						metadata.Node = node
-					}
-					metadata.SlotRange = getSlotRange(metadata.Slot)
-				}
-
-				// Apply filter
-				if matchesFilter(metadata, filter) {
-					metadataList = append(metadataList, metadata)
-				}
-			}
-			continue
-		}
+	respondWithJSON(w, http.StatusOK, presigned)
+}
 
-		// Create a metadata object from the simple metadata
-		metadata := models.Metadata{
-			FileName:      obj.Key,
-			FileSize:      *result.ContentLength,
-			SolanaVersion: simpleMetadata.SolanaVersion,
-			Status:        simpleMetadata.Status,
-			UploadedBy:    simpleMetadata.UploadedBy,
-		}
+// isDownloadAllowed checks a key against the configured download patterns
+func (h *Handler) isDownloadAllowed(key string) bool {
+	if len(h.downloadPatterns) == 0 {
+		return true
+	}
 
-		// Extract slot and node from filename if it's a snapshot file
-		if isSnapshotMetadataFile(obj.Key) {
-			slot, node := extractSlotAndNode(obj.Key)
-			metadata.Slot = slot
-			metadata.Node = node
-			metadata.SlotRange = getSlotRange(slot)
+	for _, pattern := range h.downloadPatterns {
+		if pattern.MatchString(key) {
+			return true
 		}
+	}
 
-		// Apply filter
-		if matchesFilter(metadata, filter) {
-			metadataList = append(metadataList, metadata)
+	return false
+}
+
+// sanitizeFilename reduces a requested download filename to a safe base name
+func sanitizeFilename(filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			return -1
 		}
+		return r
+	}, filename)
+
+	if i := strings.LastIndex(filename, "/"); i >= 0 {
+		filename = filename[i+1:]
 	}
 
-	log.Printf("ListMetadata: Processed %d metadata files, %d match filters", len(metadataFiles), len(metadataList))
+	return strings.TrimSpace(filename)
+}
 
-	// Sort by timestamp (newest first) if we have timestamps
-	sort.Slice(metadataList, func(i, j int) bool {
-		// If timestamps are zero, sort by slot
-		if metadataList[i].Timestamp.IsZero() || metadataList[j].Timestamp.IsZero() {
-			return metadataList[i].Slot > metadataList[j].Slot
-		}
-		return metadataList[i].Timestamp.After(metadataList[j].Timestamp)
-	})
+// ListMetadata lists metadata for .tar.gz files
+func (h *Handler) ListMetadata(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
-	// Get total count before pagination
-	totalCount := len(metadataList)
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
 
-	// Apply pagination
-	start, end := calculatePaginationBounds(page, pageSize, totalCount)
-	if start < totalCount {
-		if end > totalCount {
-			end = totalCount
-		}
-		metadataList = metadataList[start:end]
-	} else {
-		metadataList = []models.Metadata{}
+	log.Printf("ListMetadata: Request received for source %s with query: %s", source.Name, r.URL.RawQuery)
+
+	sortKeys, err := parseSortParams(r)
+	if err != nil {
+		log.Printf("ListMetadata: Invalid sort: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Prepare response
-	result := struct {
-		Items []models.Metadata `json:"items"`
-		Total int               `json:"total"`
-	}{
-		Items: metadataList,
-		Total: totalCount,
+	metadataList, err := filterMetadata(r, source)
+	if err != nil {
+		log.Printf("ListMetadata: Invalid query: %v", err)
+		respondWithQueryError(w, err)
+		return
 	}
 
-	log.Printf("ListMetadata: Returning %d items (page %d/%d)", len(metadataList), page, (totalCount+pageSize-1)/pageSize)
+	log.Printf("ListMetadata: %d of %d catalog entries match filters", len(metadataList), source.catalog.Len())
+
+	sortMetadata(metadataList, sortKeys)
+
+	result, err := paginate(r, metadataList, sortSpec(sortKeys), metadataLess(sortKeys), metadataAnchor)
+	if err != nil {
+		log.Printf("ListMetadata: Invalid cursor: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Printf("ListMetadata: Returning %d of %d items", len(result.Items), result.Total)
 
 	// Return response
 	respondWithJSON(w, http.StatusOK, result)
@@ -746,10 +840,21 @@ func (h *Handler) GetMetadata(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("GetMetadata: Fetching metadata for key: %s", key)
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("GetMetadata: Fetching metadata for key %s of source %s", key, source.Name)
+
+	// Snapshot metadata files are served from the catalog
+	if metadata, ok := source.catalog.Get(key); ok {
+		respondWithJSON(w, http.StatusOK, metadata)
+		return
+	}
 
 	// Get object directly from S3 (skip cache for now since it's causing issues)
-	result, err := h.s3Service.GetObject(r.Context(), key)
+	result, err := source.store.GetObject(r.Context(), key)
 	if err != nil {
 		log.Printf("GetMetadata: Failed to get object %s: %v", key, err)
 		respondWithError(w, http.StatusNotFound, "Metadata not found")
@@ -767,115 +872,46 @@ func (h *Handler) GetMetadata(w http.ResponseWriter, r *http.Request) {
 
 	// If it's a metadata file, parse it
 	if strings.HasSuffix(key, ".json") {
-		log.Printf("GetMetadata: Parsing JSON metadata for %s", key)
-
-		// Try to parse with the simplified struct first
-		var simpleMetadata SimpleMetadata
-		err = json.Unmarshal(body, &simpleMetadata)
-		if err != nil {
-			log.Printf("GetMetadata: Failed to parse simple metadata %s: %v", key, err)
-
-			// Try to parse as a generic map as a fallback
-			var rawData map[string]interface{}
-			if jsonErr := json.Unmarshal(body, &rawData); jsonErr == nil {
-				log.Printf("GetMetadata: Parsed as raw JSON map: %v", rawData)
-
-				// Create a metadata object from the raw data
-				metadata := models.Metadata{
-					FileName: key,
-					FileSize: *result.ContentLength,
-				}
-
-				// Extract fields from the raw data
-				if version, ok := rawData["solana_version"].(string); ok {
-					metadata.SolanaVersion = version
-				}
-				if status, ok := rawData["status"].(string); ok {
-					metadata.Status = status
-				}
-				if uploader, ok := rawData["uploaded_by"].(string); ok {
-					metadata.UploadedBy = uploader
-				}
-				if slot, ok := rawData["slot"].(float64); ok {
-					metadata.Slot = int64(slot)
-				}
-				if hash, ok := rawData["hash"].(string); ok {
-					metadata.Hash = hash
-				}
-				if timestamp, ok := rawData["timestamp"].(float64); ok {
-					metadata.Timestamp = time.Unix(int64(timestamp), 0)
-				}
-
-				// Extract slot and node from filename if it's a snapshot file
-				if isSnapshotMetadataFile(key) {
-					slot, node := extractSlotAndNode(key)
-					if metadata.Slot == 0 && slot > 0 {
-						metadata.Slot = slot
-					}
-					if metadata.Node == "" && node != "" {
-						metadata.Node = node
-					}
-					metadata.SlotRange = getSlotRange(metadata.Slot)
-				}
-
-				log.Printf("GetMetadata: Returning metadata from raw JSON: %+v", metadata)
-				respondWithJSON(w, http.StatusOK, metadata)
-				return
-			} else {
-				// If we can't parse it as JSON at all, return the raw content
-				log.Printf("GetMetadata: Could not parse as JSON at all: %v", jsonErr)
-				w.Header().Set("Content-Type", http.DetectContentType(body))
-				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
-				w.WriteHeader(http.StatusOK)
-				w.Write(body)
-				return
+		metadata, err := parseMetadata(key, body)
+		if err == nil {
+			if match, ok := h.registry.Match(key); ok {
+				applyArtifact(&metadata, match)
 			}
+			respondWithJSON(w, http.StatusOK, metadata)
+			return
 		}
-
-		// Create a metadata object from the simple metadata
-		log.Printf("GetMetadata: Successfully parsed simple metadata: %+v", simpleMetadata)
-		metadata := models.Metadata{
-			FileName:      key,
-			FileSize:      *result.ContentLength,
-			SolanaVersion: simpleMetadata.SolanaVersion,
-			Status:        simpleMetadata.Status,
-			UploadedBy:    simpleMetadata.UploadedBy,
-		}
-
-		// Extract slot and node from filename if it's a snapshot file
-		if isSnapshotMetadataFile(key) {
-			slot, node := extractSlotAndNode(key)
-			metadata.Slot = slot
-			metadata.Node = node
-			metadata.SlotRange = getSlotRange(slot)
-		}
-
-		log.Printf("GetMetadata: Returning metadata: %+v", metadata)
-		respondWithJSON(w, http.StatusOK, metadata)
-		return
-	} else {
-		// If it's not a metadata file, return the raw content
-		log.Printf("GetMetadata: Not a JSON file, returning raw content for %s", key)
-		w.Header().Set("Content-Type", http.DetectContentType(body))
-		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
-		w.WriteHeader(http.StatusOK)
-		w.Write(body)
-		return
+		log.Printf("GetMetadata: Could not parse %s as JSON: %v", key, err)
 	}
+
+	// Otherwise return the raw content
+	w.Header().Set("Content-Type", http.DetectContentType(body))
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
 }
 
 // WebSocketHandler handles WebSocket connections
 func (h *Handler) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	h.hub.ServeWs(w, r)
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	source.hub.ServeWs(w, r)
 }
 
 // DebugReindex is a debug endpoint to manually trigger the indexing process
 func (h *Handler) DebugReindex(w http.ResponseWriter, r *http.Request) {
-	log.Println("Manual reindex triggered")
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("Manual reindex of source %s triggered", source.Name)
 
 	// Clear the cache for metadata options if available
 	if h.cacheService != nil {
-		err := h.cacheService.Delete(context.Background(), metadataOptionsKey)
+		err := h.cacheService.Delete(context.Background(), source.cacheKey())
 		if err != nil {
 			log.Printf("Failed to delete cache: %v", err)
 		}
@@ -883,10 +919,11 @@ func (h *Handler) DebugReindex(w http.ResponseWriter, r *http.Request) {
 		log.Println("Cache service not available, skipping cache deletion")
 	}
 
-	// Start indexing in a goroutine
+	// Start indexing in a goroutine, fetching every metadata file again
 	go func() {
 		ctx := context.Background()
-		h.indexMetadata(ctx)
+		source.catalog.Reset()
+		h.indexMetadata(ctx, source)
 	}()
 
 	// Respond with success
@@ -899,21 +936,24 @@ func (h *Handler) DebugReindex(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DebugExamineFile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Get the first metadata file
-	objects, err := h.s3Service.ListObjects(ctx, "")
-	if err != nil {
-		log.Printf("Failed to list objects: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to list objects")
+	source, ok := h.requestSource(w, r)
+	if !ok {
 		return
 	}
 
-	// Find the first metadata file
+	// Walk the bucket until the first metadata file is found
 	var metadataFile string
-	for _, obj := range objects {
-		if obj.IsMetadata && isSnapshotMetadataFile(obj.Key) {
+	err := source.store.WalkObjects(ctx, "", func(obj storage.Object) error {
+		if obj.IsMetadata && h.registry.IsMetadataFile(obj.Key) {
 			metadataFile = obj.Key
-			break
+			return storage.ErrStopWalk
 		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, storage.ErrListTruncated) {
+		log.Printf("Failed to list objects: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list objects")
+		return
 	}
 
 	if metadataFile == "" {
@@ -922,7 +962,7 @@ func (h *Handler) DebugExamineFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the file content
-	result, err := h.s3Service.GetObject(ctx, metadataFile)
+	result, err := source.store.GetObject(ctx, metadataFile)
 	if err != nil {
 		log.Printf("Failed to get metadata file %s: %v", metadataFile, err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get metadata file")
@@ -962,6 +1002,20 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
 
+// respondWithQueryError responds with a 400 pointing at the position of a
+// query syntax error
+func respondWithQueryError(w http.ResponseWriter, err error) {
+	var queryErr *query.Error
+	if !errors.As(err, &queryErr) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":    queryErr.Error(),
+		"position": queryErr.Pos,
+	})
+}
+
 // respondWithJSON responds with JSON
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, err := json.Marshal(payload)
@@ -976,6 +1030,15 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
+// clearWriteDeadline lifts the server's write timeout for a handler that
+// streams a whole object before responding, which can take far longer
+func clearWriteDeadline(w http.ResponseWriter) {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to clear the write deadline: %v", err)
+	}
+}
+
 // getPaginationParams gets pagination parameters from the request
 func getPaginationParams(r *http.Request) (int, int) {
 	pageStr := r.URL.Query().Get("page")
@@ -1018,6 +1081,41 @@ func calculatePaginationBounds(page, pageSize, totalItems int) (int, int) {
 	return start, end
 }
 
+// hasMetadataFilter reports whether the request has any metadata filter
+func hasMetadataFilter(r *http.Request) bool {
+	params := r.URL.Query()
+	for _, param := range metadataFilterParams {
+		if params.Get(param) != "" {
+			return true
+		}
+	}
+	for param := range params {
+		if strings.HasPrefix(param, extraFilterPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterMetadata returns the catalog entries of a source matching the
+// request's filter parameters and q= query
+func filterMetadata(r *http.Request, source *Source) ([]models.Metadata, error) {
+	filter := parseMetadataFilter(r)
+
+	q, err := query.Parse(r.URL.Query().Get("q"))
+	if err != nil {
+		return nil, err
+	}
+
+	var metadataList []models.Metadata
+	for _, metadata := range source.catalog.Metadata() {
+		if matchesFilter(metadata, filter) && q.Match(metadata) {
+			metadataList = append(metadataList, metadata)
+		}
+	}
+	return metadataList, nil
+}
+
 // parseMetadataFilter parses metadata filter from the request
 func parseMetadataFilter(r *http.Request) models.MetadataFilter {
 	// Get query parameters
@@ -1033,9 +1131,29 @@ func parseMetadataFilter(r *http.Request) models.MetadataFilter {
 		UploadedBy:    query.Get("uploadedBy"),
 		Node:          query.Get("node"),
 		SlotRange:     query.Get("slotRange"),
+		SnapshotType:  query.Get("snapshotType"),
+		ArtifactType:  query.Get("artifactType"),
 		SearchTerm:    query.Get("searchTerm"),
 	}
 
+	// Parse feature set
+	if featureSet := query.Get("solanaFeatureSet"); featureSet != "" {
+		if val, err := strconv.Atoi(featureSet); err == nil {
+			filter.SolanaFeatureSet = val
+		} else {
+			log.Printf("Failed to parse solanaFeatureSet: %v", err)
+		}
+	}
+
+	// Parse base slot
+	if baseSlot := query.Get("baseSlot"); baseSlot != "" {
+		if val, err := strconv.ParseInt(baseSlot, 10, 64); err == nil {
+			filter.BaseSlot = val
+		} else {
+			log.Printf("Failed to parse baseSlot: %v", err)
+		}
+	}
+
 	// Parse min slot
 	if minSlot := query.Get("minSlot"); minSlot != "" {
 		if val, err := strconv.ParseInt(minSlot, 10, 64); err == nil {
@@ -1073,6 +1191,16 @@ func parseMetadataFilter(r *http.Request) models.MetadataFilter {
 		}
 	}
 
+	// Parse extra fields
+	for param, values := range query {
+		if key := strings.TrimPrefix(param, extraFilterPrefix); key != param && key != "" {
+			if filter.Extra == nil {
+				filter.Extra = make(map[string]string)
+			}
+			filter.Extra[key] = values[0]
+		}
+	}
+
 	// Log the parsed filter
 	log.Printf("Parsed filter: %+v", filter)
 
@@ -1081,14 +1209,16 @@ func parseMetadataFilter(r *http.Request) models.MetadataFilter {
 
 // matchesFilter checks if metadata matches the filter
 func matchesFilter(metadata models.Metadata, filter models.MetadataFilter) bool {
-	// Log the filter being applied
-	log.Printf("Applying filter: %+v to metadata: %+v", filter, metadata)
-
 	// Check Solana version
 	if filter.SolanaVersion != "" && metadata.SolanaVersion != filter.SolanaVersion {
 		return false
 	}
 
+	// Check feature set
+	if filter.SolanaFeatureSet != 0 && metadata.SolanaFeatureSet != filter.SolanaFeatureSet {
+		return false
+	}
+
 	// Check status
 	if filter.Status != "" && metadata.Status != filter.Status {
 		return false
@@ -1109,6 +1239,21 @@ func matchesFilter(metadata models.Metadata, filter models.MetadataFilter) bool
 		return false
 	}
 
+	// Check snapshot type
+	if filter.SnapshotType != "" && metadata.SnapshotType != filter.SnapshotType {
+		return false
+	}
+
+	// Check artifact type
+	if filter.ArtifactType != "" && metadata.ArtifactType != filter.ArtifactType {
+		return false
+	}
+
+	// Check base slot
+	if filter.BaseSlot > 0 && metadata.BaseSlot != filter.BaseSlot {
+		return false
+	}
+
 	// Check min slot
 	if filter.MinSlot > 0 && metadata.Slot < filter.MinSlot {
 		return false
@@ -1129,6 +1274,13 @@ func matchesFilter(metadata models.Metadata, filter models.MetadataFilter) bool
 		return false
 	}
 
+	// Check extra fields
+	for key, want := range filter.Extra {
+		if value, ok := metadata.ExtraValue(key); !ok || value != want {
+			return false
+		}
+	}
+
 	// Check search term (case insensitive)
 	if filter.SearchTerm != "" {
 		searchTerm := strings.ToLower(filter.SearchTerm)
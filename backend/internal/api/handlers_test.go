@@ -1,103 +1,345 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
 )
 
-func TestIsSnapshotMetadataFile(t *testing.T) {
+func TestBuildBreadcrumbs(t *testing.T) {
 	tests := []struct {
-		name     string
-		filename string
-		want     bool
+		name       string
+		prefix     string
+		want       []Breadcrumb
+		wantParent string
 	}{
 		{
-			name:     "valid snapshot metadata file",
-			filename: "snapshot-123456789-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
-			want:     true,
-		},
-		{
-			name:     "valid snapshot metadata file with longer slot",
-			filename: "snapshot-9876543210-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
-			want:     true,
-		},
-		{
-			name:     "invalid - not a json file",
-			filename: "snapshot-123456789-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.tar.gz",
-			want:     false,
+			name:       "bucket root",
+			prefix:     "",
+			want:       []Breadcrumb{{Name: "/", Prefix: ""}},
+			wantParent: "",
 		},
 		{
-			name:     "invalid - wrong format",
-			filename: "snapshot_123456789_AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
-			want:     false,
+			name:   "nested prefix",
+			prefix: "mainnet/node-a/",
+			want: []Breadcrumb{
+				{Name: "/", Prefix: ""},
+				{Name: "mainnet", Prefix: "mainnet/"},
+				{Name: "node-a", Prefix: "mainnet/node-a/"},
+			},
+			wantParent: "mainnet/",
 		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildBreadcrumbs(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildBreadcrumbs() = %v, want %v", got, tt.want)
+			}
+			if got := parentPrefix(tt.prefix); got != tt.wantParent {
+				t.Errorf("parentPrefix() = %q, want %q", got, tt.wantParent)
+			}
+		})
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := map[string]string{
+		"":         "",
+		"/":        "",
+		"mainnet":  "mainnet/",
+		"/mainnet": "mainnet/",
+		"a/b/":     "a/b/",
+	}
+
+	for in, want := range tests {
+		if got := normalizePrefix(in); got != want {
+			t.Errorf("normalizePrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"snapshot.tar.gz":      "snapshot.tar.gz",
+		"../../etc/passwd":     "passwd",
+		"evil\"; x=\"y.tar.gz": "evil; x=y.tar.gz",
+		"line\r\nbreak.tar.gz": "linebreak.tar.gz",
+		"  padded.tar.gz  ":    "padded.tar.gz",
+	}
+
+	for in, want := range tests {
+		if got := sanitizeFilename(in); got != want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// newMetadataRouter serves a router for a single source whose catalog is
+// synced from the given metadata files
+func newMetadataRouter(t *testing.T, files map[string]string) *mux.Router {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	for key, body := range files {
+		putObject(t, store, key, body)
+	}
+	source := NewSource("mainnet", config.BackendMemory, store)
+	if _, err := source.catalog.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	return router
+}
+
+func TestListMetadataQuery(t *testing.T) {
+	router := newMetadataRouter(t, map[string]string{
+		"snapshot-100-" + testNode + ".json": `{"solana_version":"1.18.1","status":"ok"}`,
+		"snapshot-200-" + testNode + ".json": `{"solana_version":"1.18.2","status":"verified"}`,
+		"snapshot-300-" + testNode + ".json": `{"solana_version":"1.17.9","status":"failed"}`,
+	})
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantSlots []int64
+		wantPos   int
+	}{
 		{
-			name:     "invalid - no slot",
-			filename: "snapshot-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
-			want:     false,
+			name:      "field group and comparison",
+			query:     "status:(ok OR verified) slot:>=200",
+			wantCode:  http.StatusOK,
+			wantSlots: []int64{200},
 		},
 		{
-			name:     "invalid - no node",
-			filename: "snapshot-123456789.json",
-			want:     false,
+			name:      "negated wildcard",
+			query:     "-version:1.18.*",
+			wantCode:  http.StatusOK,
+			wantSlots: []int64{300},
 		},
 		{
-			name:     "invalid - random json file",
-			filename: "metadata.json",
-			want:     false,
+			name:     "syntax error",
+			query:    "status:ok AND slot:abc",
+			wantCode: http.StatusBadRequest,
+			wantPos:  19,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := isSnapshotMetadataFile(tt.filename); got != tt.want {
-				t.Errorf("isSnapshotMetadataFile() = %v, want %v for filename %s", got, tt.want, tt.filename)
+			path := "/api/metadata?q=" + url.QueryEscape(tt.query)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s code = %d, want %d", path, rec.Code, tt.wantCode)
+			}
+
+			if tt.wantCode != http.StatusOK {
+				var body struct {
+					Error    string `json:"error"`
+					Position int    `json:"position"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if body.Position != tt.wantPos || body.Error == "" {
+					t.Errorf("GET %s error = %+v, want position %d", path, body, tt.wantPos)
+				}
+				return
+			}
+
+			var body struct {
+				Items []models.Metadata `json:"items"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			var slots []int64
+			for _, item := range body.Items {
+				slots = append(slots, item.Slot)
+			}
+			if !reflect.DeepEqual(slots, tt.wantSlots) {
+				t.Errorf("GET %s slots = %v, want %v", path, slots, tt.wantSlots)
 			}
 		})
 	}
 }
 
-func TestExtractSlotAndNode(t *testing.T) {
+func TestListMetadataExtraFilter(t *testing.T) {
+	router := newMetadataRouter(t, map[string]string{
+		"snapshot-100-" + testNode + ".json": `{"region":"eu","replicas":3}`,
+		"snapshot-200-" + testNode + ".json": `{"region":"us","replicas":3}`,
+		"snapshot-300-" + testNode + ".json": `{"status":"ok"}`,
+	})
+
+	tests := map[string][]int64{
+		"/api/metadata?extra.region=eu":                  {100},
+		"/api/metadata?extra.replicas=3":                 {200, 100},
+		"/api/metadata?extra.replicas=3&extra.region=us": {200},
+		"/api/metadata?extra.region=asia":                nil,
+	}
+	for path, wantSlots := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s code = %d, want %d", path, rec.Code, http.StatusOK)
+		}
+
+		var body struct {
+			Items []models.Metadata `json:"items"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		var slots []int64
+		for _, item := range body.Items {
+			slots = append(slots, item.Slot)
+		}
+		if !reflect.DeepEqual(slots, wantSlots) {
+			t.Errorf("GET %s slots = %v, want %v", path, slots, wantSlots)
+		}
+	}
+}
+
+func TestSortMetadata(t *testing.T) {
+	metadata := []models.Metadata{
+		{FileName: "a.json", Slot: 100, SolanaVersion: "1.18.10", Status: "ok", Timestamp: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{FileName: "b.json", Slot: 200, SolanaVersion: "1.18.9", Status: "ok"},
+		{FileName: "c.json", Slot: 300, SolanaVersion: "1.18.9", Status: "failed", Timestamp: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{FileName: "d.json", Slot: 300, SolanaVersion: "1.18.9", Status: "failed", Timestamp: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
 	tests := []struct {
-		name     string
-		filename string
-		wantSlot int64
-		wantNode string
+		name      string
+		params    string
+		wantFiles []string
+		wantErr   bool
 	}{
 		{
-			name:     "valid snapshot metadata file",
-			filename: "snapshot-123456789-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
-			wantSlot: 123456789,
-			wantNode: "AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96",
+			name:      "default is newest first with missing timestamps last",
+			wantFiles: []string{"a.json", "c.json", "d.json", "b.json"},
 		},
 		{
-			name:     "valid snapshot metadata file with longer slot",
-			filename: "snapshot-9876543210-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
-			wantSlot: 9876543210,
-			wantNode: "AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96",
+			name:      "semantic version ascending",
+			params:    "sort=solana_version,slot",
+			wantFiles: []string{"b.json", "c.json", "d.json", "a.json"},
 		},
 		{
-			name:     "invalid - not a json file",
-			filename: "snapshot-123456789-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.tar.gz",
-			wantSlot: 0,
-			wantNode: "",
+			name:      "per key order",
+			params:    "sort=status,slot&order=desc,asc",
+			wantFiles: []string{"a.json", "b.json", "c.json", "d.json"},
 		},
 		{
-			name:     "invalid - wrong format",
-			filename: "snapshot_123456789_AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
-			wantSlot: 0,
-			wantNode: "",
+			name:      "single order applies to every key and ties break on key",
+			params:    "sort=solana_version,slot&order=desc",
+			wantFiles: []string{"a.json", "c.json", "d.json", "b.json"},
 		},
+		{
+			name:      "missing timestamps sort last in either direction",
+			params:    "sort=timestamp&order=asc",
+			wantFiles: []string{"c.json", "d.json", "a.json", "b.json"},
+		},
+		{name: "unsupported field", params: "sort=hash", wantErr: true},
+		{name: "unsupported order", params: "sort=slot&order=up", wantErr: true},
+		{name: "mismatched orders", params: "sort=slot,node,status&order=asc,desc", wantErr: true},
+		{name: "order without sort", params: "order=asc", wantErr: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotSlot, gotNode := extractSlotAndNode(tt.filename)
-			if gotSlot != tt.wantSlot {
-				t.Errorf("extractSlotAndNode() slot = %v, want %v for filename %s", gotSlot, tt.wantSlot, tt.filename)
+			keys, err := parseSortParams(httptest.NewRequest(http.MethodGet, "/api/metadata?"+tt.params, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSortParams(%q) error = %v, wantErr %v", tt.params, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			sorted := append([]models.Metadata(nil), metadata...)
+			// Reverse the input so that the result does not depend on it
+			for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+				sorted[i], sorted[j] = sorted[j], sorted[i]
+			}
+			sortMetadata(sorted, keys)
+
+			var files []string
+			for _, m := range sorted {
+				files = append(files, m.FileName)
 			}
-			if gotNode != tt.wantNode {
-				t.Errorf("extractSlotAndNode() node = %v, want %v for filename %s", gotNode, tt.wantNode, tt.filename)
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("sortMetadata(%q) = %v, want %v", tt.params, files, tt.wantFiles)
 			}
 		})
 	}
 }
+
+func TestGetMetadataOptionsFacets(t *testing.T) {
+	router := newMetadataRouter(t, map[string]string{
+		"snapshot-100-" + testNode + ".json": `{"solana_version":"1.18.1","status":"ok"}`,
+		"snapshot-200-" + testNode + ".json": `{"solana_version":"1.18.1","status":"verified"}`,
+		"snapshot-300-" + testNode + ".json": `{"solana_version":"1.17.9","status":"failed"}`,
+	})
+
+	path := "/api/metadata/options?q=" + url.QueryEscape("status:(ok OR verified)")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s code = %d, want %d", path, rec.Code, http.StatusOK)
+	}
+
+	var options FilterOptions
+	if err := json.Unmarshal(rec.Body.Bytes(), &options); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !reflect.DeepEqual(options.SolanaVersions, []string{"1.18.1"}) {
+		t.Errorf("GET %s versions = %v, want [1.18.1]", path, options.SolanaVersions)
+	}
+	wantStatuses := map[string]int{"ok": 1, "verified": 1}
+	if !reflect.DeepEqual(options.Counts.Statuses, wantStatuses) {
+		t.Errorf("GET %s status counts = %v, want %v", path, options.Counts.Statuses, wantStatuses)
+	}
+	if got := options.Counts.SolanaVersions["1.18.1"]; got != 2 {
+		t.Errorf("GET %s count of 1.18.1 = %d, want 2", path, got)
+	}
+	if got := options.Counts.Nodes[testNode]; got != 2 {
+		t.Errorf("GET %s count of node = %d, want 2", path, got)
+	}
+}
+
+func TestClearWriteDeadline(t *testing.T) {
+	for _, clear := range []bool{false, true} {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if clear {
+				clearWriteDeadline(w)
+			}
+			time.Sleep(100 * time.Millisecond)
+			respondWithJSON(w, http.StatusOK, "done")
+		}))
+		server.Config.WriteTimeout = 50 * time.Millisecond
+		server.Start()
+
+		resp, err := http.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != clear {
+			t.Errorf("GET with the write deadline cleared = %v: error = %v", clear, err)
+		}
+		server.Close()
+	}
+}
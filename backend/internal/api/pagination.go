@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// errInvalidCursor is returned for cursors that cannot be decoded or that
+// were issued for a different sort
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks a position in a sorted listing. It holds the sort key values
+// of the item at the edge of a page rather than an offset, so that pages stay
+// stable while items are added or removed.
+type cursor struct {
+	Sort   string          `json:"s"`
+	Before bool            `json:"b,omitempty"`
+	Anchor json.RawMessage `json:"a"`
+}
+
+// encodeCursor encodes a cursor before or after the given item
+func encodeCursor[T any](sortSpec string, item T, before bool) string {
+	anchor, err := json.Marshal(item)
+	if err != nil {
+		return ""
+	}
+	data, err := json.Marshal(cursor{Sort: sortSpec, Before: before, Anchor: anchor})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor and its anchor item, checking that it was
+// issued for the same sort
+func decodeCursor[T any](value, sortSpec string) (cursor, T, error) {
+	var c cursor
+	var anchor T
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, anchor, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, anchor, errInvalidCursor
+	}
+	if c.Sort != sortSpec {
+		return c, anchor, errors.New("cursor was issued for a different sort")
+	}
+	if err := json.Unmarshal(c.Anchor, &anchor); err != nil {
+		return c, anchor, errInvalidCursor
+	}
+	return c, anchor, nil
+}
+
+// paginate returns one page of items sorted by less, selected by the cursor
+// parameter if it is set and by the page and page_size parameters otherwise.
+// anchor reduces an item to the fields less compares, which is what cursors
+// carry.
+func paginate[T any](r *http.Request, items []T, sortSpec string, less func(a, b T) bool, anchor func(T) T) (models.List[T], error) {
+	page, pageSize := getPaginationParams(r)
+	total := len(items)
+	list := models.List[T]{Total: total, PageSize: pageSize}
+
+	var start, end int
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		c, edge, err := decodeCursor[T](value, sortSpec)
+		if err != nil {
+			return list, err
+		}
+		if c.Before {
+			end = sort.Search(total, func(i int) bool { return !less(items[i], edge) })
+			start = max(end-pageSize, 0)
+		} else {
+			start = sort.Search(total, func(i int) bool { return less(edge, items[i]) })
+			end = min(start+pageSize, total)
+		}
+	} else {
+		list.Page = page
+		start, end = calculatePaginationBounds(page, pageSize, total)
+	}
+
+	list.Items = items[start:end]
+	if len(list.Items) == 0 {
+		list.Items = []T{}
+		return list, nil
+	}
+	if end < total {
+		list.Next = encodeCursor(sortSpec, anchor(items[end-1]), false)
+	}
+	if start > 0 {
+		list.Prev = encodeCursor(sortSpec, anchor(items[start]), true)
+	}
+	return list, nil
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+func paginateKeys(t *testing.T, keys []string, params url.Values) models.List[storage.Object] {
+	t.Helper()
+
+	objects := make([]storage.Object, len(keys))
+	for i, key := range keys {
+		objects[i] = storage.Object{Key: key}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/files?"+params.Encode(), nil)
+	list, err := paginate(r, objects, "key:asc", func(a, b storage.Object) bool {
+		return a.Key < b.Key
+	}, func(obj storage.Object) storage.Object {
+		return obj
+	})
+	if err != nil {
+		t.Fatalf("paginate(%s) error = %v", params.Encode(), err)
+	}
+	return list
+}
+
+func listKeys(list models.List[storage.Object]) []string {
+	keys := []string{}
+	for _, obj := range list.Items {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestPaginateCursors(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	first := paginateKeys(t, keys, url.Values{"page_size": {"2"}})
+	if got := listKeys(first); !reflect.DeepEqual(got, []string{"a", "b"}) || first.Page != 1 || first.Total != 5 {
+		t.Fatalf("first page = %v (page %d, total %d), want [a b]", got, first.Page, first.Total)
+	}
+	if first.Prev != "" || first.Next == "" {
+		t.Fatalf("first page cursors = %q, %q, want only next", first.Prev, first.Next)
+	}
+
+	// New items before the cursor do not shift the next page
+	keys = []string{"a", "aa", "ab", "b", "c", "d", "e"}
+	second := paginateKeys(t, keys, url.Values{"page_size": {"2"}, "cursor": {first.Next}})
+	if got := listKeys(second); !reflect.DeepEqual(got, []string{"c", "d"}) || second.Page != 0 {
+		t.Fatalf("second page = %v (page %d), want [c d]", got, second.Page)
+	}
+
+	last := paginateKeys(t, keys, url.Values{"page_size": {"2"}, "cursor": {second.Next}})
+	if got := listKeys(last); !reflect.DeepEqual(got, []string{"e"}) || last.Next != "" {
+		t.Fatalf("last page = %v (next %q), want [e] and no next", got, last.Next)
+	}
+
+	prev := paginateKeys(t, keys, url.Values{"page_size": {"2"}, "cursor": {second.Prev}})
+	if got := listKeys(prev); !reflect.DeepEqual(got, []string{"ab", "b"}) || prev.Prev == "" {
+		t.Fatalf("previous page = %v (prev %q), want [ab b] and a prev", got, prev.Prev)
+	}
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	objects := []storage.Object{{Key: "a"}}
+	less := func(a, b storage.Object) bool { return a.Key < b.Key }
+	anchor := func(obj storage.Object) storage.Object { return obj }
+
+	valid := encodeCursor("key:asc", objects[0], false)
+	for _, tt := range []struct {
+		name   string
+		cursor string
+		sort   string
+	}{
+		{name: "garbage", cursor: "not a cursor", sort: "key:asc"},
+		{name: "different sort", cursor: valid, sort: "key:desc"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/files?cursor="+url.QueryEscape(tt.cursor), nil)
+			if _, err := paginate(r, objects, tt.sort, less, anchor); err == nil {
+				t.Errorf("paginate() with cursor %q error = nil, want an error", tt.cursor)
+			}
+		})
+	}
+}
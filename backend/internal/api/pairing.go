@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/artifact"
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+// PairingReport checks that every archive has its sidecar metadata file and
+// every metadata file has an archive, and that the size a metadata file
+// declares is the size of its archive. Only artifact types with a sidecar
+// are checked.
+type PairingReport struct {
+	Archives int `json:"archives"`
+	Pairs    int `json:"pairs"`
+	// ArchivesWithoutMetadata lists archives whose metadata file is missing
+	ArchivesWithoutMetadata []OrphanObject `json:"archives_without_metadata"`
+	// MetadataWithoutArchives lists metadata files without any archive
+	MetadataWithoutArchives []OrphanObject `json:"metadata_without_archives"`
+	SizeMismatches          []SizeMismatch `json:"size_mismatches"`
+	// OrphanBytes is the size of all orphans, the sum of the other two
+	OrphanBytes         int64 `json:"orphan_bytes"`
+	OrphanArchiveBytes  int64 `json:"orphan_archive_bytes"`
+	OrphanMetadataBytes int64 `json:"orphan_metadata_bytes"`
+}
+
+// OrphanObject is an archive or metadata file missing its counterpart
+type OrphanObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	// MetadataKey is the missing metadata file of an archive
+	MetadataKey string `json:"metadata_key,omitempty"`
+}
+
+// SizeMismatch is an archive whose size differs from the file_size of its
+// metadata file
+type SizeMismatch struct {
+	Archive      string `json:"archive"`
+	Metadata     string `json:"metadata"`
+	ArchiveSize  int64  `json:"archive_size"`
+	MetadataSize int64  `json:"metadata_size"`
+}
+
+// Clean reports whether nothing is missing or mismatched
+func (r *PairingReport) Clean() bool {
+	return len(r.ArchivesWithoutMetadata) == 0 && len(r.MetadataWithoutArchives) == 0 && len(r.SizeMismatches) == 0
+}
+
+// buildPairingReport pairs the archives and metadata files of a listing.
+// lookup returns the catalog entry of a metadata file. Sizes are only
+// compared if the metadata file declares file_size.
+func buildPairingReport(objects []storage.Object, registry *artifact.Registry, lookup func(key string) (models.Metadata, bool)) PairingReport {
+	report := PairingReport{
+		ArchivesWithoutMetadata: []OrphanObject{},
+		MetadataWithoutArchives: []OrphanObject{},
+		SizeMismatches:          []SizeMismatch{},
+	}
+
+	metadataFiles := make(map[string]storage.Object)
+	var archives []storage.Object
+	var archiveMatches []artifact.Match
+	for _, obj := range objects {
+		match, ok := registry.Match(obj.Key)
+		if !ok || match.MetadataKey == "" {
+			continue
+		}
+		if match.MetadataKey == obj.Key {
+			metadataFiles[obj.Key] = obj
+			continue
+		}
+		archives = append(archives, obj)
+		archiveMatches = append(archiveMatches, match)
+	}
+
+	paired := make(map[string]bool)
+	for i, obj := range archives {
+		report.Archives++
+		metadataKey := archiveMatches[i].MetadataKey
+
+		_, ok := metadataFiles[metadataKey]
+		if !ok {
+			report.ArchivesWithoutMetadata = append(report.ArchivesWithoutMetadata, OrphanObject{
+				Key:          obj.Key,
+				Size:         obj.Size,
+				LastModified: obj.LastModified,
+				MetadataKey:  metadataKey,
+			})
+			report.OrphanArchiveBytes += obj.Size
+			continue
+		}
+
+		report.Pairs++
+		paired[metadataKey] = true
+
+		metadata, ok := lookup(metadataKey)
+		if ok && metadata.FileSizeDeclared && metadata.FileSize != obj.Size {
+			report.SizeMismatches = append(report.SizeMismatches, SizeMismatch{
+				Archive:      obj.Key,
+				Metadata:     metadataKey,
+				ArchiveSize:  obj.Size,
+				MetadataSize: metadata.FileSize,
+			})
+		}
+	}
+
+	for key, obj := range metadataFiles {
+		if paired[key] {
+			continue
+		}
+		report.MetadataWithoutArchives = append(report.MetadataWithoutArchives, OrphanObject{
+			Key:          key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		})
+		report.OrphanMetadataBytes += obj.Size
+	}
+	sort.Slice(report.MetadataWithoutArchives, func(i, j int) bool {
+		return report.MetadataWithoutArchives[i].Key < report.MetadataWithoutArchives[j].Key
+	})
+
+	report.OrphanBytes = report.OrphanArchiveBytes + report.OrphanMetadataBytes
+	return report
+}
+
+// CheckPairing lists a store and reports how its archives and metadata
+// files pair up. It is used by the pairing command, which runs without the
+// API handler.
+func CheckPairing(ctx context.Context, store storage.ObjectStore, cfg *config.Config) (PairingReport, error) {
+	// Artifact types are validated when the config is loaded
+	registry := artifact.DefaultRegistry()
+	if len(cfg.Artifacts) > 0 {
+		registry = artifact.MustNewRegistry(cfg.Artifacts)
+	}
+
+	catalog := NewCatalog()
+	catalog.registry = registry
+	if _, err := catalog.Sync(ctx, store); err != nil {
+		return PairingReport{}, err
+	}
+
+	return buildPairingReport(catalog.Objects(), registry, catalog.Get), nil
+}
+
+// GetPairing reports the archives of a source without metadata files, the
+// metadata files without archives and the pairs whose sizes disagree
+func (h *Handler) GetPairing(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	report := buildPairingReport(source.catalog.Objects(), h.registry, source.catalog.Get)
+
+	log.Printf("GetPairing: %d of %d archives in source %s are paired, %d metadata files are orphans",
+		report.Pairs, report.Archives, source.Name, len(report.MetadataWithoutArchives))
+
+	respondWithJSON(w, http.StatusOK, report)
+}
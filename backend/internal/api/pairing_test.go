@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetPairing(t *testing.T) {
+	paired := "snapshot-100-" + testNode
+	mismatched := "snapshot-200-" + testNode
+	collision := "snapshot-400-" + testNode
+	router := newMetadataRouter(t, map[string]string{
+		// A metadata file without file_size is paired without comparing sizes
+		paired + ".json":        `{"solana_version":"1.18.1"}`,
+		paired + ".tar.zst":     "archive",
+		mismatched + ".json":    `{"file_size":5}`,
+		mismatched + ".tar.zst": "1234567",
+		// The declared file_size happens to be the metadata file's own size
+		collision + ".json":                                  `{"file_size":16}`,
+		collision + ".tar.zst":                               "archive",
+		"snapshot-300-" + testNode + ".tar.zst":              "abc",
+		"incremental-snapshot-100-150-" + testNode + ".json": `{}`,
+		"notes.txt": "not an artifact",
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/analysis/pairing", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/analysis/pairing code = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var report PairingReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if report.Archives != 4 || report.Pairs != 3 || report.Clean() {
+		t.Errorf("report = %d archives and %d pairs, want 4 and 3", report.Archives, report.Pairs)
+	}
+	if len(report.ArchivesWithoutMetadata) != 1 || report.ArchivesWithoutMetadata[0].MetadataKey != "snapshot-300-"+testNode+".json" {
+		t.Errorf("archives without metadata = %+v", report.ArchivesWithoutMetadata)
+	}
+	if len(report.MetadataWithoutArchives) != 1 || report.MetadataWithoutArchives[0].Key != "incremental-snapshot-100-150-"+testNode+".json" {
+		t.Errorf("metadata without archives = %+v", report.MetadataWithoutArchives)
+	}
+	if report.OrphanArchiveBytes != 3 || report.OrphanMetadataBytes != 2 || report.OrphanBytes != 5 {
+		t.Errorf("orphan bytes = %d + %d = %d, want 3 + 2 = 5", report.OrphanArchiveBytes, report.OrphanMetadataBytes, report.OrphanBytes)
+	}
+
+	want := []SizeMismatch{
+		{Archive: mismatched + ".tar.zst", Metadata: mismatched + ".json", ArchiveSize: 7, MetadataSize: 5},
+		{Archive: collision + ".tar.zst", Metadata: collision + ".json", ArchiveSize: 7, MetadataSize: 16},
+	}
+	if !reflect.DeepEqual(report.SizeMismatches, want) {
+		t.Errorf("size mismatches = %+v, want %+v", report.SizeMismatches, want)
+	}
+}
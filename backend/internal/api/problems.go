@@ -0,0 +1,64 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/schema"
+)
+
+// ProblemReport lists the metadata files of a source that could not be
+// parsed or do not conform to the schema
+type ProblemReport struct {
+	// Files is the number of metadata files with problems
+	Files int `json:"files"`
+	// Counts is the number of problems of each class
+	Counts map[string]int `json:"counts"`
+	Items  []FileProblems `json:"items"`
+}
+
+// buildProblemReport counts the problems of every file by class and keeps
+// the files with problems of the given class, or all files if class is empty
+func buildProblemReport(files []FileProblems, class string) ProblemReport {
+	report := ProblemReport{
+		Files:  len(files),
+		Counts: make(map[string]int),
+		Items:  []FileProblems{},
+	}
+
+	for _, file := range files {
+		var matching []schema.Problem
+		for _, problem := range file.Problems {
+			report.Counts[problem.Class]++
+			if class == "" || problem.Class == class {
+				matching = append(matching, problem)
+			}
+		}
+		if len(matching) > 0 {
+			report.Items = append(report.Items, FileProblems{Key: file.Key, Problems: matching})
+		}
+	}
+
+	return report
+}
+
+// GetIndexProblems reports the metadata files found while indexing that
+// could not be parsed or do not conform to the schema, with the number of
+// problems by class. The class parameter limits the files listed.
+func (h *Handler) GetIndexProblems(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	report := buildProblemReport(source.catalog.Problems(), r.URL.Query().Get("class"))
+
+	log.Printf("GetIndexProblems: %d metadata files of source %s have problems", report.Files, source.Name)
+
+	respondWithJSON(w, http.StatusOK, report)
+}
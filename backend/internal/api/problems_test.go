@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/schema"
+)
+
+func TestGetIndexProblems(t *testing.T) {
+	valid := "snapshot-100-" + testNode + ".json"
+	incomplete := "snapshot-200-" + testNode + ".json"
+	broken := "snapshot-300-" + testNode + ".json"
+	router := newMetadataRouter(t, map[string]string{
+		valid:      `{"solana_version":"1.18.1","solana_feature_set":1,"status":"ok","uploaded_by":"node-a"}`,
+		incomplete: `{"solana_version":"1.18.1","solana_feature_set":"one","status":"ok"}`,
+		broken:     `{"solana_version":`,
+	})
+
+	tests := []struct {
+		path      string
+		wantFiles []string
+	}{
+		{path: "/api/index/problems", wantFiles: []string{incomplete, broken}},
+		{path: "/api/index/problems?class=" + schema.ClassParseError, wantFiles: []string{broken}},
+		{path: "/api/index/problems?class=" + schema.ClassUnknownField},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s code = %d, want %d", tt.path, rec.Code, http.StatusOK)
+		}
+
+		var report ProblemReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+
+		wantCounts := map[string]int{schema.ClassParseError: 1, schema.ClassMissingField: 1, schema.ClassInvalidValue: 1}
+		if report.Files != 2 || len(report.Counts) != len(wantCounts) {
+			t.Errorf("GET %s = %d files with counts %v, want 2 files with counts %v", tt.path, report.Files, report.Counts, wantCounts)
+		}
+		for class, want := range wantCounts {
+			if report.Counts[class] != want {
+				t.Errorf("GET %s count of %s = %d, want %d", tt.path, class, report.Counts[class], want)
+			}
+		}
+
+		if len(report.Items) != len(tt.wantFiles) {
+			t.Fatalf("GET %s items = %+v, want %v", tt.path, report.Items, tt.wantFiles)
+		}
+		for i, item := range report.Items {
+			if item.Key != tt.wantFiles[i] {
+				t.Errorf("GET %s item %d = %s, want %s", tt.path, i, item.Key, tt.wantFiles[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// SnapshotArtifact is a snapshot archive with its metadata and, if the
+// backend supports it, a presigned download URL
+type SnapshotArtifact struct {
+	Key          string                `json:"key"`
+	Size         int64                 `json:"size"`
+	LastModified time.Time             `json:"last_modified"`
+	Metadata     models.Metadata       `json:"metadata"`
+	Download     *storage.PresignedURL `json:"download,omitempty"`
+}
+
+// LatestSnapshots is the newest full snapshot and the newest incremental
+// snapshot taken on top of it
+type LatestSnapshots struct {
+	Full        *SnapshotArtifact `json:"full"`
+	Incremental *SnapshotArtifact `json:"incremental"`
+}
+
+// snapshotConstraints restrict the snapshots LatestSnapshot chooses from
+type snapshotConstraints struct {
+	version    string
+	featureSet int
+	node       string
+	maxAge     time.Duration
+}
+
+// parseSnapshotConstraints parses the version, feature_set, node and max_age
+// parameters. version may contain * wildcards; node is the producer of the
+// snapshot, as returned by Metadata.Producer; max_age is a duration such as
+// 6h or a number of seconds.
+func parseSnapshotConstraints(r *http.Request) (snapshotConstraints, error) {
+	query := r.URL.Query()
+	constraints := snapshotConstraints{
+		version: query.Get("version"),
+		node:    query.Get("node"),
+	}
+
+	if constraints.version != "" {
+		if _, err := path.Match(constraints.version, ""); err != nil {
+			return constraints, fmt.Errorf("invalid version pattern %q", constraints.version)
+		}
+	}
+
+	if value := query.Get("feature_set"); value != "" {
+		featureSet, err := strconv.Atoi(value)
+		if err != nil {
+			return constraints, fmt.Errorf("invalid feature_set %q", value)
+		}
+		constraints.featureSet = featureSet
+	}
+
+	if value := query.Get("max_age"); value != "" {
+		maxAge, err := parseDuration(value)
+		if err != nil || maxAge <= 0 {
+			return constraints, fmt.Errorf("invalid max_age %q", value)
+		}
+		constraints.maxAge = maxAge
+	}
+
+	return constraints, nil
+}
+
+// parseDuration parses a duration such as 6h, or a number of seconds
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// matches reports whether an artifact satisfies the constraints at time now
+func (c snapshotConstraints) matches(a ArtifactObject, now time.Time) bool {
+	if c.version != "" {
+		if ok, _ := path.Match(c.version, a.Metadata.SolanaVersion); !ok {
+			return false
+		}
+	}
+	if c.featureSet != 0 && a.Metadata.SolanaFeatureSet != c.featureSet {
+		return false
+	}
+	if c.node != "" && a.Metadata.Producer() != c.node {
+		return false
+	}
+	if c.maxAge > 0 && now.Sub(artifactTime(a)) > c.maxAge {
+		return false
+	}
+	return true
+}
+
+// artifactTime returns when an artifact was created: the timestamp from its
+// metadata if it has one, and the time it was stored otherwise
+func artifactTime(a ArtifactObject) time.Time {
+	return metadataTime(a.Metadata, map[string]time.Time{a.Metadata.FileName: a.Object.LastModified})
+}
+
+// selectLatestSnapshots returns the full snapshot with the highest slot that
+// satisfies the constraints, and the incremental snapshot with the highest
+// slot that satisfies them and is based on it. Either is nil if there is none.
+func selectLatestSnapshots(artifacts []ArtifactObject, constraints snapshotConstraints, now time.Time) (full, incremental *ArtifactObject) {
+	newest := func(snapshotType string, baseSlot int64) *ArtifactObject {
+		var best *ArtifactObject
+		for i := range artifacts {
+			a := &artifacts[i]
+			if a.Metadata.SnapshotType != snapshotType || !constraints.matches(*a, now) {
+				continue
+			}
+			if snapshotType == models.SnapshotTypeIncremental && a.Metadata.BaseSlot != baseSlot {
+				continue
+			}
+			if best == nil || a.Metadata.Slot > best.Metadata.Slot ||
+				a.Metadata.Slot == best.Metadata.Slot && a.Object.Key < best.Object.Key {
+				best = a
+			}
+		}
+		return best
+	}
+
+	full = newest(models.SnapshotTypeFull, 0)
+	if full != nil {
+		incremental = newest(models.SnapshotTypeIncremental, full.Metadata.Slot)
+	}
+	return full, incremental
+}
+
+// LatestSnapshot returns the newest full snapshot and the newest incremental
+// snapshot based on it, optionally restricted by version, feature set, node
+// and age. The node is the snapshot's producer: the uploaded_by field of its
+// metadata file, or its node field if that is not just the hash in the file
+// name. Snapshots whose producer is unknown never match a node.
+func (h *Handler) LatestSnapshot(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	constraints, err := parseSnapshotConstraints(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	full, incremental := selectLatestSnapshots(source.catalog.Artifacts(), constraints, time.Now())
+	if full == nil {
+		log.Printf("LatestSnapshot: No full snapshot in source %s matches %s", source.Name, r.URL.RawQuery)
+		respondWithError(w, http.StatusNotFound, "No snapshot matches the constraints")
+		return
+	}
+
+	latest := LatestSnapshots{Full: h.snapshotArtifact(r.Context(), source, *full)}
+	if incremental != nil {
+		latest.Incremental = h.snapshotArtifact(r.Context(), source, *incremental)
+	}
+
+	respondWithJSON(w, http.StatusOK, latest)
+}
+
+// snapshotArtifact describes a snapshot archive, presigning a download URL
+// for it if the backend supports it and downloading the key is allowed
+func (h *Handler) snapshotArtifact(ctx context.Context, source *Source, a ArtifactObject) *SnapshotArtifact {
+	snapshot := &SnapshotArtifact{
+		Key:          a.Object.Key,
+		Size:         a.Object.Size,
+		LastModified: a.Object.LastModified,
+		Metadata:     a.Metadata,
+	}
+
+	presigner, ok := source.store.(storage.Presigner)
+	if !ok || !h.isDownloadAllowed(a.Object.Key) {
+		return snapshot
+	}
+
+	presigned, err := presigner.PresignGetObject(ctx, a.Object.Key, h.downloadExpiry, "")
+	if err != nil {
+		log.Printf("LatestSnapshot: Failed to presign %s: %v", a.Object.Key, err)
+		return snapshot
+	}
+	snapshot.Download = presigned
+
+	return snapshot
+}
+
+// RedirectSnapshot redirects to the newest full snapshot, like the
+// /snapshot.tar.bz2 endpoint of a Solana RPC node
+func (h *Handler) RedirectSnapshot(w http.ResponseWriter, r *http.Request) {
+	h.redirectSnapshot(w, r, false)
+}
+
+// RedirectIncrementalSnapshot redirects to the newest incremental snapshot
+// based on the newest full snapshot, like the /incremental-snapshot.tar.bz2
+// endpoint of a Solana RPC node
+func (h *Handler) RedirectIncrementalSnapshot(w http.ResponseWriter, r *http.Request) {
+	h.redirectSnapshot(w, r, true)
+}
+
+// redirectSnapshot answers a snapshot download with a 303 redirect to a
+// presigned URL of the chosen archive. The same constraints as for
+// LatestSnapshot may be passed as parameters, and the node as a path prefix.
+// The node is matched against each snapshot's producer, so the full snapshot
+// and the incremental based on it come from the same node. Validators take
+// the snapshot's slot and hash from the file name at the end of the redirect,
+// which is the archive's own name.
+func (h *Handler) redirectSnapshot(w http.ResponseWriter, r *http.Request, incremental bool) {
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	constraints, err := parseSnapshotConstraints(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if node, ok := mux.Vars(r)["node"]; ok {
+		constraints.node = node
+	}
+
+	full, incrementalSnapshot := selectLatestSnapshots(source.catalog.Artifacts(), constraints, time.Now())
+	snapshot := full
+	if incremental {
+		snapshot = incrementalSnapshot
+	}
+	if snapshot == nil {
+		log.Printf("RedirectSnapshot: No snapshot in source %s for %s", source.Name, r.URL.Path)
+		respondWithError(w, http.StatusNotFound, "No snapshot available")
+		return
+	}
+
+	key := snapshot.Object.Key
+	if !h.isDownloadAllowed(key) {
+		respondWithError(w, http.StatusForbidden, "Downloading this key is not allowed")
+		return
+	}
+
+	presigner, ok := source.store.(storage.Presigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "The storage backend does not support download URLs")
+		return
+	}
+
+	presigned, err := presigner.PresignGetObject(r.Context(), key, h.downloadExpiry, "")
+	if err != nil {
+		log.Printf("RedirectSnapshot: Failed to presign %s: %v", key, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create download URL: "+err.Error())
+		return
+	}
+
+	log.Printf("RedirectSnapshot: Redirecting %s to %s", r.URL.Path, key)
+	http.Redirect(w, r, presigned.URL, http.StatusSeeOther)
+}
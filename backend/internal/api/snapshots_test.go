@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// presigningStore presigns URLs on a fake bucket host
+type presigningStore struct {
+	*storage.MemoryStore
+}
+
+func (p presigningStore) PresignGetObject(ctx context.Context, key string, expiry time.Duration, filename string) (*storage.PresignedURL, error) {
+	return &storage.PresignedURL{URL: "https://bucket.example/" + key, ExpiresAt: time.Now().Add(expiry)}, nil
+}
+
+func TestSelectLatestSnapshots(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := func(key, snapshotType string, slot, baseSlot int64, version string, featureSet int, node string, age time.Duration) ArtifactObject {
+		return ArtifactObject{
+			Object: storage.Object{Key: key, LastModified: now.Add(-age)},
+			Metadata: models.Metadata{
+				FileName:         key,
+				SnapshotType:     snapshotType,
+				Slot:             slot,
+				BaseSlot:         baseSlot,
+				SolanaVersion:    version,
+				SolanaFeatureSet: featureSet,
+				UploadedBy:       node,
+			},
+		}
+	}
+	artifacts := []ArtifactObject{
+		snapshot("full-100", models.SnapshotTypeFull, 100, 0, "1.18.2", 7, "a", 10*time.Hour),
+		snapshot("full-200", models.SnapshotTypeFull, 200, 0, "1.18.3", 8, "b", 2*time.Hour),
+		snapshot("inc-100-150", models.SnapshotTypeIncremental, 150, 100, "1.18.2", 7, "a", 5*time.Hour),
+		snapshot("inc-100-180", models.SnapshotTypeIncremental, 180, 100, "1.18.2", 7, "a", 4*time.Hour),
+		snapshot("inc-200-250", models.SnapshotTypeIncremental, 250, 200, "1.18.3", 8, "b", time.Hour),
+		snapshot("inc-200-300", models.SnapshotTypeIncremental, 300, 200, "1.18.4", 9, "b", time.Minute),
+	}
+
+	tests := []struct {
+		name            string
+		constraints     snapshotConstraints
+		wantFull        string
+		wantIncremental string
+	}{
+		{
+			name:            "no constraints",
+			wantFull:        "full-200",
+			wantIncremental: "inc-200-300",
+		},
+		{
+			name:            "version wildcard",
+			constraints:     snapshotConstraints{version: "1.18.2*"},
+			wantFull:        "full-100",
+			wantIncremental: "inc-100-180",
+		},
+		{
+			name:            "feature set",
+			constraints:     snapshotConstraints{featureSet: 8},
+			wantFull:        "full-200",
+			wantIncremental: "inc-200-250",
+		},
+		{
+			name:            "node",
+			constraints:     snapshotConstraints{node: "a"},
+			wantFull:        "full-100",
+			wantIncremental: "inc-100-180",
+		},
+		{
+			name:        "max age excludes every full snapshot",
+			constraints: snapshotConstraints{maxAge: time.Hour},
+		},
+		{
+			name:        "no full snapshot for the version",
+			constraints: snapshotConstraints{version: "1.18.4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full, incremental := selectLatestSnapshots(artifacts, tt.constraints, now)
+
+			var gotFull, gotIncremental string
+			if full != nil {
+				gotFull = full.Object.Key
+			}
+			if incremental != nil {
+				gotIncremental = incremental.Object.Key
+			}
+			if gotFull != tt.wantFull || gotIncremental != tt.wantIncremental {
+				t.Errorf("selectLatestSnapshots() = %q, %q, want %q, %q",
+					gotFull, gotIncremental, tt.wantFull, tt.wantIncremental)
+			}
+		})
+	}
+}
+
+func TestLatestSnapshot(t *testing.T) {
+	router := newMetadataRouter(t, map[string]string{
+		"snapshot-100-" + testNode + ".json":                    `{"solana_version":"1.17.9","uploaded_by":"validator-1"}`,
+		"snapshot-100-" + testNode + ".tar.zst":                 "archive",
+		"snapshot-200-" + testNode + ".json":                    `{"solana_version":"1.18.2"}`,
+		"snapshot-200-" + testNode + ".tar.zst":                 "archive",
+		"snapshot-300-" + testNode + ".json":                    `{"solana_version":"1.18.3"}`,
+		"incremental-snapshot-200-250-" + testNode + ".tar.zst": "archive",
+		"incremental-snapshot-100-150-" + testNode + ".tar.zst": "archive",
+	})
+
+	tests := []struct {
+		name            string
+		query           string
+		wantCode        int
+		wantFull        string
+		wantIncremental string
+	}{
+		{
+			name:            "newest full snapshot with an archive",
+			wantCode:        http.StatusOK,
+			wantFull:        "snapshot-200-" + testNode + ".tar.zst",
+			wantIncremental: "incremental-snapshot-200-250-" + testNode + ".tar.zst",
+		},
+		{
+			name:     "version constraint",
+			query:    "?version=1.17.*",
+			wantCode: http.StatusOK,
+			wantFull: "snapshot-100-" + testNode + ".tar.zst",
+		},
+		{
+			name:     "node is the producer",
+			query:    "?node=validator-1",
+			wantCode: http.StatusOK,
+			wantFull: "snapshot-100-" + testNode + ".tar.zst",
+		},
+		{name: "the hash in the file name is not a node", query: "?node=" + testNode, wantCode: http.StatusNotFound},
+		{name: "no match", query: "?node=other", wantCode: http.StatusNotFound},
+		{name: "invalid max age", query: "?max_age=soon", wantCode: http.StatusBadRequest},
+		{name: "invalid feature set", query: "?feature_set=x", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/snapshots/latest"+tt.query, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var latest LatestSnapshots
+			if err := json.NewDecoder(rec.Body).Decode(&latest); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if latest.Full == nil || latest.Full.Key != tt.wantFull {
+				t.Errorf("full = %+v, want %q", latest.Full, tt.wantFull)
+			}
+			var gotIncremental string
+			if latest.Incremental != nil {
+				gotIncremental = latest.Incremental.Key
+			}
+			if gotIncremental != tt.wantIncremental {
+				t.Errorf("incremental = %q, want %q", gotIncremental, tt.wantIncremental)
+			}
+		})
+	}
+}
+
+func TestRedirectSnapshot(t *testing.T) {
+	// Every archive has its own hash in its name, as written by a validator,
+	// and its producer in its metadata file
+	const (
+		full100        = "snapshot-100-" + testNode
+		incremental150 = "incremental-snapshot-100-150-4Hs3kTzVvJXcKyE2mDcnPq8bRjwYxL6Fk9sGtNvUe1Wa"
+		incremental180 = "incremental-snapshot-100-180-7rTpQ2nWxYzKd5MjLv3HcBfGs8aEu4NbVkXmJ9qRtPwC"
+		full200        = "snapshot-200-9QxCLckBiJc783jnMvXZubK4wH86Eqqvashtrwvcsgkv"
+	)
+
+	store := storage.NewMemoryStore()
+	for key, producer := range map[string]string{
+		full100:        "validator-a",
+		incremental150: "validator-a",
+		incremental180: "validator-b",
+		full200:        "validator-b",
+	} {
+		putObject(t, store, key+".tar.zst", "archive")
+		putObject(t, store, key+".json", `{"uploaded_by":"`+producer+`"}`)
+	}
+	source := NewSource("mainnet", config.BackendS3, presigningStore{store})
+	if _, err := source.catalog.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{
+		Download: config.DownloadConfig{URLExpirySeconds: 900, MaxURLExpirySeconds: 3600},
+	})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "newest full snapshot",
+			path:         "/snapshot.tar.bz2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "https://bucket.example/" + full200 + ".tar.zst",
+		},
+		{
+			name:     "no incremental for the newest full snapshot",
+			path:     "/incremental-snapshot.tar.bz2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "full snapshot of a node",
+			path:         "/nodes/validator-a/snapshot.tar.bz2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "https://bucket.example/" + full100 + ".tar.zst",
+		},
+		{
+			name:         "incremental snapshot of a node",
+			path:         "/sources/mainnet/nodes/validator-a/incremental-snapshot.tar.bz2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "https://bucket.example/" + incremental150 + ".tar.zst",
+		},
+		{
+			name:     "incremental of another node on a full snapshot it did not produce",
+			path:     "/nodes/validator-b/incremental-snapshot.tar.bz2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "the hash in the file name is not a node",
+			path:     "/nodes/" + testNode + "/snapshot.tar.bz2",
+			wantCode: http.StatusNotFound,
+		},
+		{name: "unknown source", path: "/sources/devnet/snapshot.tar.bz2", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if location := rec.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
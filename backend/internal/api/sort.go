@@ -0,0 +1,166 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// metadataComparators compare two metadata entries by a sortable field,
+// returning -1, 0 or 1
+var metadataComparators = map[string]func(a, b models.Metadata) int{
+	"slot": func(a, b models.Metadata) int {
+		return cmp.Compare(a.Slot, b.Slot)
+	},
+	"timestamp": func(a, b models.Metadata) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	},
+	"uploaded_at": func(a, b models.Metadata) int {
+		return a.UploadedAt.Compare(b.UploadedAt)
+	},
+	"base_slot": func(a, b models.Metadata) int {
+		return cmp.Compare(a.BaseSlot, b.BaseSlot)
+	},
+	"file_size": func(a, b models.Metadata) int {
+		return cmp.Compare(a.FileSize, b.FileSize)
+	},
+	"solana_version": func(a, b models.Metadata) int {
+		return models.CompareVersions(a.SolanaVersion, b.SolanaVersion)
+	},
+	"node": func(a, b models.Metadata) int {
+		return strings.Compare(a.Node, b.Node)
+	},
+	"status": func(a, b models.Metadata) int {
+		return strings.Compare(a.Status, b.Status)
+	},
+}
+
+// missingLast lists the fields whose zero values sort after all other values
+// regardless of the sort order
+var missingLast = map[string]func(m models.Metadata) bool{
+	"timestamp":      func(m models.Metadata) bool { return m.Timestamp.IsZero() },
+	"uploaded_at":    func(m models.Metadata) bool { return m.UploadedAt.IsZero() },
+	"solana_version": func(m models.Metadata) bool { return m.SolanaVersion == "" },
+}
+
+// defaultSort is the metadata order when no sort is requested: newest first
+var defaultSort = []sortKey{
+	{field: "timestamp", desc: true},
+	{field: "slot", desc: true},
+}
+
+// sortKey is a field to sort by and its direction
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// parseSortParams parses the sort and order parameters. sort is a comma
+// separated list of fields; order is either a single direction applied to
+// every field or a comma separated direction per field.
+func parseSortParams(r *http.Request) ([]sortKey, error) {
+	sortParam := r.URL.Query().Get("sort")
+	orderParam := r.URL.Query().Get("order")
+	if sortParam == "" {
+		if orderParam != "" {
+			return nil, fmt.Errorf("order requires sort")
+		}
+		return defaultSort, nil
+	}
+
+	fields := strings.Split(sortParam, ",")
+	var orders []string
+	if orderParam != "" {
+		orders = strings.Split(orderParam, ",")
+		if len(orders) != 1 && len(orders) != len(fields) {
+			return nil, fmt.Errorf("order must have one direction or one per sort field")
+		}
+	}
+
+	keys := make([]sortKey, 0, len(fields))
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if _, ok := metadataComparators[field]; !ok {
+			return nil, fmt.Errorf("unsupported sort field %q", field)
+		}
+
+		order := "asc"
+		if len(orders) == 1 {
+			order = orders[0]
+		} else if len(orders) > 0 {
+			order = orders[i]
+		}
+		switch strings.ToLower(strings.TrimSpace(order)) {
+		case "asc":
+			keys = append(keys, sortKey{field: field})
+		case "desc":
+			keys = append(keys, sortKey{field: field, desc: true})
+		default:
+			return nil, fmt.Errorf("unsupported sort order %q", order)
+		}
+	}
+	return keys, nil
+}
+
+// sortMetadata sorts metadata by the given keys
+func sortMetadata(metadataList []models.Metadata, keys []sortKey) {
+	less := metadataLess(keys)
+	sort.SliceStable(metadataList, func(i, j int) bool {
+		return less(metadataList[i], metadataList[j])
+	})
+}
+
+// metadataLess orders metadata by the given keys, breaking ties by file name
+// so that the order is total and deterministic
+func metadataLess(keys []sortKey) func(a, b models.Metadata) bool {
+	return func(a, b models.Metadata) bool {
+		for _, key := range keys {
+			if isMissing, ok := missingLast[key.field]; ok {
+				missingA, missingB := isMissing(a), isMissing(b)
+				if missingA != missingB {
+					return missingB
+				}
+			}
+
+			cmp := metadataComparators[key.field](a, b)
+			if key.desc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return a.FileName < b.FileName
+	}
+}
+
+// sortSpec returns the canonical form of a sort, which cursors are tied to
+func sortSpec(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.field + ":asc"
+		if key.desc {
+			parts[i] = key.field + ":desc"
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// metadataAnchor reduces metadata to the fields metadataLess compares
+func metadataAnchor(m models.Metadata) models.Metadata {
+	return models.Metadata{
+		FileName:      m.FileName,
+		Slot:          m.Slot,
+		BaseSlot:      m.BaseSlot,
+		Timestamp:     m.Timestamp,
+		UploadedAt:    m.UploadedAt,
+		FileSize:      m.FileSize,
+		SolanaVersion: m.SolanaVersion,
+		Node:          m.Node,
+		Status:        m.Status,
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// Source represents a named object store with its own catalog and WebSocket hub
+type Source struct {
+	Name          string
+	Backend       string
+	store         storage.ObjectStore
+	catalog       *Catalog
+	hub           *Hub
+	filterOptions *FilterOptions
+	optionsLock   sync.RWMutex
+	// reportedConflicts are the hash conflicts and mismatches already
+	// alerted, guarded by consensusLock
+	reportedConflicts map[string]bool
+	consensusLock     sync.Mutex
+	// verifying are the keys of the objects being verified
+	verifying  map[string]bool
+	verifyLock sync.Mutex
+	// manifests are the archive manifests listed, by key and ETag
+	manifests manifestCache
+}
+
+// SourceInfo describes a source to API clients
+type SourceInfo struct {
+	Name    string `json:"name"`
+	Backend string `json:"backend"`
+	Default bool   `json:"default"`
+}
+
+// NewSource creates a new source serving the given store
+func NewSource(name, backend string, store storage.ObjectStore) *Source {
+	catalog := NewCatalog()
+
+	return &Source{
+		Name:          name,
+		Backend:       backend,
+		store:         store,
+		catalog:       catalog,
+		hub:           NewHub(catalog),
+		filterOptions: emptyFilterOptions(),
+		verifying:     make(map[string]bool),
+	}
+}
+
+// restoreCatalog loads a source's catalog from the on-disk index and builds
+// its filter options from it
+func (h *Handler) restoreCatalog(source *Source) {
+	if err := source.catalog.AttachIndex(h.catalogIndex, source.Name); err != nil {
+		log.Printf("Failed to restore the catalog of source %s, rebuilding it: %v", source.Name, err)
+		return
+	}
+
+	if source.catalog.SyncedAt().IsZero() {
+		return
+	}
+
+	source.optionsLock.Lock()
+	source.filterOptions = buildFilterOptions(source.catalog.Metadata())
+	source.optionsLock.Unlock()
+
+	log.Printf("Restored %d objects and %d metadata files of source %s, last synced at %s",
+		len(source.catalog.Objects()), source.catalog.Len(), source.Name, source.catalog.SyncedAt().Format(time.RFC3339))
+}
+
+// watchSource indexes a source and then keeps its catalog up to date
+func (h *Handler) watchSource(ctx context.Context, source *Source) {
+	h.indexMetadata(ctx, source)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.indexMetadata(ctx, source)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// cacheKey returns the cache key for the source's filter options
+func (s *Source) cacheKey() string {
+	return metadataOptionsKey + ":" + s.Name
+}
+
+// requestSource returns the source a request is scoped to. Routes without a
+// source name are served by the default source. If the named source does not
+// exist, a 404 is written and false is returned.
+func (h *Handler) requestSource(w http.ResponseWriter, r *http.Request) (*Source, bool) {
+	name, ok := mux.Vars(r)["source"]
+	if !ok {
+		return h.sources[0], true
+	}
+
+	source, ok := h.sourcesByName[name]
+	if !ok {
+		log.Printf("Request for unknown source %q", name)
+		respondWithError(w, http.StatusNotFound, "Unknown source: "+name)
+		return nil, false
+	}
+
+	return source, true
+}
+
+// lookupObject returns a listed object of a source. Before the first sync, or
+// if the last listing was partial, objects missing from the listing are looked
+// up in the store.
+func lookupObject(ctx context.Context, source *Source, key string) (storage.Object, error) {
+	if obj, ok := source.catalog.Object(key); ok {
+		return obj, nil
+	}
+	if !source.catalog.SyncedAt().IsZero() && !source.catalog.Partial() {
+		return storage.Object{}, storage.ErrNotFound
+	}
+
+	obj, err := source.store.HeadObject(ctx, key)
+	if err != nil {
+		return storage.Object{}, err
+	}
+	return *obj, nil
+}
+
+// ListSources lists the configured sources
+func (h *Handler) ListSources(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	sources := make([]SourceInfo, 0, len(h.sources))
+	for i, source := range h.sources {
+		sources = append(sources, SourceInfo{
+			Name:    source.Name,
+			Backend: source.Backend,
+			Default: i == 0,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, sources)
+}
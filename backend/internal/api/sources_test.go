@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// newTestRouter serves a router for memory-backed sources, each seeded with
+// the given keys
+func newTestRouter(t *testing.T, sources map[string][]string, order ...string) *mux.Router {
+	t.Helper()
+
+	var apiSources []*Source
+	for _, name := range order {
+		store := storage.NewMemoryStore()
+		for _, key := range sources[name] {
+			if err := store.PutObject(context.Background(), key, strings.NewReader("{}")); err != nil {
+				t.Fatalf("PutObject(%q) error = %v", key, err)
+			}
+		}
+		apiSources = append(apiSources, NewSource(name, config.BackendMemory, store))
+	}
+
+	cfg := &config.Config{
+		Download: config.DownloadConfig{URLExpirySeconds: 900, MaxURLExpirySeconds: 3600},
+	}
+	handler := NewHandler(apiSources, nil, nil, cfg)
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	return router
+}
+
+func TestSourceScopedRoutes(t *testing.T) {
+	router := newTestRouter(t, map[string][]string{
+		"mainnet": {"mainnet-a.json", "mainnet-b.json"},
+		"testnet": {"testnet-a.json"},
+	}, "mainnet", "testnet")
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantKeys []string
+	}{
+		{
+			name:     "unscoped route uses the default source",
+			path:     "/api/files",
+			wantCode: http.StatusOK,
+			wantKeys: []string{"mainnet-a.json", "mainnet-b.json"},
+		},
+		{
+			name:     "scoped route uses the named source",
+			path:     "/api/sources/testnet/files",
+			wantCode: http.StatusOK,
+			wantKeys: []string{"testnet-a.json"},
+		},
+		{
+			name:     "unknown source",
+			path:     "/api/sources/devnet/files",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET %s code = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var list models.List[storage.Object]
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			objects := list.Items
+			if len(objects) != len(tt.wantKeys) {
+				t.Fatalf("GET %s returned %d objects, want %d", tt.path, len(objects), len(tt.wantKeys))
+			}
+			for i, obj := range objects {
+				if obj.Key != tt.wantKeys[i] {
+					t.Errorf("GET %s object %d = %q, want %q", tt.path, i, obj.Key, tt.wantKeys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListSources(t *testing.T) {
+	router := newTestRouter(t, map[string][]string{}, "mainnet", "testnet")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sources", nil))
+
+	var sources []SourceInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &sources); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(sources) != 2 || sources[0].Name != "mainnet" || !sources[0].Default || sources[1].Default {
+		t.Errorf("ListSources() = %+v", sources)
+	}
+}
+
+func TestListFilesArtifactType(t *testing.T) {
+	router := newTestRouter(t, map[string][]string{
+		"mainnet": {
+			"incremental-snapshot-100-150-" + testNode + ".tar.zst",
+			"notes.txt",
+			"snapshot-100-" + testNode + ".tar.zst",
+		},
+	}, "mainnet")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/files?type=snapshot", nil))
+
+	var list models.List[storage.Object]
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].ArtifactType != "snapshot" || !list.Items[0].IsTarGz {
+		t.Errorf("GET /api/files?type=snapshot = %+v, want the full snapshot archive", list.Items)
+	}
+}
+
+// partialStore lists only the objects of the wrapped store before failing
+type partialStore struct {
+	*storage.MemoryStore
+}
+
+func (p *partialStore) ListObjects(ctx context.Context, prefix string) ([]storage.Object, error) {
+	objects, err := p.MemoryStore.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return objects, &storage.PartialListError{Pages: 1, Objects: len(objects), Err: storage.ErrListTruncated}
+}
+
+func TestListFilesPartial(t *testing.T) {
+	memory := storage.NewMemoryStore()
+	putObject(t, memory, "snapshot-100-"+testNode+".tar.zst", "archive")
+	source := NewSource("mainnet", config.BackendMemory, &partialStore{MemoryStore: memory})
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// Before the first sync the store is listed directly, and after it the
+	// catalog remembers that its listing was partial
+	for _, synced := range []bool{false, true} {
+		if synced {
+			if _, err := source.catalog.Sync(context.Background(), source.store); err == nil {
+				t.Fatal("Sync() error = nil, want the partial listing error")
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/files", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/files code = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var list models.List[storage.Object]
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(list.Items) != 1 || !list.Partial {
+			t.Errorf("GET /api/files after sync %v = %d items, partial %v, want 1 partial", synced, len(list.Items), list.Partial)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/artifact"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+// defaultSlotBucket is the width of the slot histogram buckets when none is
+// requested
+const defaultSlotBucket = 1000000
+
+// Categories of objects that are not artifacts, and of missing values
+const (
+	statsMetadata = "metadata"
+	statsOther    = "other"
+	statsUnknown  = "unknown"
+)
+
+// StatsCount is a number of objects and their total size
+type StatsCount struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+// add counts an object of the given size
+func (c *StatsCount) add(size int64) {
+	c.Count++
+	c.Bytes += size
+}
+
+// TimeBucket counts the objects stored within a day or week
+type TimeBucket struct {
+	Start time.Time `json:"start"`
+	StatsCount
+}
+
+// SlotBucket counts the artifacts with slots in [Start, End)
+type SlotBucket struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	StatsCount
+}
+
+// Stats describes the composition of a source. Total, ByType and ByTime
+// cover every object; sidecar metadata files are counted as "metadata" and
+// objects of no artifact type as "other". ByNode, ByVersion, ByStatus and
+// Slots cover the artifacts, using their catalog metadata; ByNode is keyed by
+// producer, as returned by Metadata.Producer.
+type Stats struct {
+	Total      StatsCount            `json:"total"`
+	ByType     map[string]StatsCount `json:"by_type"`
+	ByNode     map[string]StatsCount `json:"by_node"`
+	ByVersion  map[string]StatsCount `json:"by_version"`
+	ByStatus   map[string]StatsCount `json:"by_status"`
+	Interval   string                `json:"interval"`
+	ByTime     []TimeBucket          `json:"by_time"`
+	SlotBucket int64                 `json:"slot_bucket"`
+	Slots      []SlotBucket          `json:"slots"`
+}
+
+// statsParams are the bucket sizes of the time and slot histograms
+type statsParams struct {
+	interval   string
+	slotBucket int64
+}
+
+// parseStatsParams parses the interval (day or week) and slot_bucket
+// parameters
+func parseStatsParams(r *http.Request) (statsParams, error) {
+	query := r.URL.Query()
+	params := statsParams{interval: "day", slotBucket: defaultSlotBucket}
+
+	if interval := query.Get("interval"); interval != "" {
+		if interval != "day" && interval != "week" {
+			return params, fmt.Errorf("unsupported interval %q, use day or week", interval)
+		}
+		params.interval = interval
+	}
+
+	if value := query.Get("slot_bucket"); value != "" {
+		width, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || width <= 0 {
+			return params, fmt.Errorf("invalid slot_bucket %q", value)
+		}
+		params.slotBucket = width
+	}
+
+	return params, nil
+}
+
+// bucketStart returns the start of the day or ISO week containing t, in UTC
+func bucketStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == "week" {
+		// Weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+// computeStats counts a listing and its artifacts
+func computeStats(objects []storage.Object, artifacts []ArtifactObject, registry *artifact.Registry, params statsParams) Stats {
+	stats := Stats{
+		ByType:     make(map[string]StatsCount),
+		ByNode:     make(map[string]StatsCount),
+		ByVersion:  make(map[string]StatsCount),
+		ByStatus:   make(map[string]StatsCount),
+		Interval:   params.interval,
+		ByTime:     []TimeBucket{},
+		SlotBucket: params.slotBucket,
+		Slots:      []SlotBucket{},
+	}
+
+	// count adds an object to the count of a key in a map
+	count := func(counts map[string]StatsCount, key string, size int64) {
+		if key == "" {
+			key = statsUnknown
+		}
+		c := counts[key]
+		c.add(size)
+		counts[key] = c
+	}
+
+	times := make(map[time.Time]*TimeBucket)
+	for _, obj := range objects {
+		stats.Total.add(obj.Size)
+
+		objectType := statsOther
+		if match, ok := registry.Match(obj.Key); ok {
+			objectType = match.Type.Name
+			if match.MetadataKey == obj.Key {
+				objectType = statsMetadata
+			}
+		}
+		count(stats.ByType, objectType, obj.Size)
+
+		if obj.LastModified.IsZero() {
+			continue
+		}
+		start := bucketStart(obj.LastModified, params.interval)
+		bucket, ok := times[start]
+		if !ok {
+			bucket = &TimeBucket{Start: start}
+			times[start] = bucket
+		}
+		bucket.add(obj.Size)
+	}
+
+	slots := make(map[int64]*SlotBucket)
+	for _, a := range artifacts {
+		size := a.Object.Size
+		count(stats.ByNode, a.Metadata.Producer(), size)
+		count(stats.ByVersion, a.Metadata.SolanaVersion, size)
+		count(stats.ByStatus, a.Metadata.Status, size)
+
+		if a.Metadata.Slot == 0 {
+			continue
+		}
+		start := a.Metadata.Slot / params.slotBucket * params.slotBucket
+		bucket, ok := slots[start]
+		if !ok {
+			bucket = &SlotBucket{Start: start, End: start + params.slotBucket}
+			slots[start] = bucket
+		}
+		bucket.add(size)
+	}
+
+	for _, bucket := range times {
+		stats.ByTime = append(stats.ByTime, *bucket)
+	}
+	sort.Slice(stats.ByTime, func(i, j int) bool { return stats.ByTime[i].Start.Before(stats.ByTime[j].Start) })
+
+	for _, bucket := range slots {
+		stats.Slots = append(stats.Slots, *bucket)
+	}
+	sort.Slice(stats.Slots, func(i, j int) bool { return stats.Slots[i].Start < stats.Slots[j].Start })
+
+	return stats
+}
+
+// GetStats returns object counts and sizes of a source broken down by
+// artifact type, node, version, status and time, and a slot histogram
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	params, err := parseStatsParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats := computeStats(source.catalog.Objects(), source.catalog.Artifacts(), h.registry, params)
+
+	log.Printf("GetStats: Counted %d objects in source %s", stats.Total.Count, source.Name)
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/artifact"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+func TestBucketStart(t *testing.T) {
+	// 2024-05-01 is a Wednesday
+	tm := time.Date(2024, 5, 1, 18, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+
+	if got, want := bucketStart(tm, "day"), time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("bucketStart(day) = %v, want %v", got, want)
+	}
+	if got, want := bucketStart(tm, "week"), time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("bucketStart(week) = %v, want %v", got, want)
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	full := storage.Object{Key: "snapshot-1500000-" + testNode + ".tar.zst", Size: 100, LastModified: day}
+	incremental := storage.Object{Key: "incremental-snapshot-1500000-2100000-" + testNode + ".tar.zst", Size: 10, LastModified: day.Add(24 * time.Hour)}
+	objects := []storage.Object{
+		full,
+		{Key: "snapshot-1500000-" + testNode + ".json", Size: 1, LastModified: day},
+		incremental,
+		{Key: "notes.txt", Size: 5},
+	}
+	artifacts := []ArtifactObject{
+		{Object: full, Metadata: models.Metadata{Slot: 1500000, Node: testNode, FileHash: testNode, UploadedBy: "validator-1", SolanaVersion: "1.18.2", Status: "verified"}},
+		// The node of the default snapshot types is the hash in the file name
+		{Object: incremental, Metadata: models.Metadata{Slot: 2100000, Node: testNode, FileHash: testNode}},
+	}
+
+	stats := computeStats(objects, artifacts, artifact.DefaultRegistry(), statsParams{interval: "day", slotBucket: 1000000})
+
+	if stats.Total != (StatsCount{Count: 4, Bytes: 116}) {
+		t.Errorf("Total = %+v", stats.Total)
+	}
+	wantTypes := map[string]StatsCount{
+		"snapshot":             {Count: 1, Bytes: 100},
+		"incremental-snapshot": {Count: 1, Bytes: 10},
+		"metadata":             {Count: 1, Bytes: 1},
+		"other":                {Count: 1, Bytes: 5},
+	}
+	if !reflect.DeepEqual(stats.ByType, wantTypes) {
+		t.Errorf("ByType = %+v, want %+v", stats.ByType, wantTypes)
+	}
+	wantVersions := map[string]StatsCount{
+		"1.18.2":  {Count: 1, Bytes: 100},
+		"unknown": {Count: 1, Bytes: 10},
+	}
+	if !reflect.DeepEqual(stats.ByVersion, wantVersions) {
+		t.Errorf("ByVersion = %+v, want %+v", stats.ByVersion, wantVersions)
+	}
+	wantNodes := map[string]StatsCount{
+		"validator-1": {Count: 1, Bytes: 100},
+		"unknown":     {Count: 1, Bytes: 10},
+	}
+	if !reflect.DeepEqual(stats.ByNode, wantNodes) {
+		t.Errorf("ByNode = %+v, want %+v", stats.ByNode, wantNodes)
+	}
+
+	// The object without a modification time is left out of the time buckets
+	wantTimes := []TimeBucket{
+		{Start: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), StatsCount: StatsCount{Count: 2, Bytes: 101}},
+		{Start: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), StatsCount: StatsCount{Count: 1, Bytes: 10}},
+	}
+	if !reflect.DeepEqual(stats.ByTime, wantTimes) {
+		t.Errorf("ByTime = %+v, want %+v", stats.ByTime, wantTimes)
+	}
+
+	wantSlots := []SlotBucket{
+		{Start: 1000000, End: 2000000, StatsCount: StatsCount{Count: 1, Bytes: 100}},
+		{Start: 2000000, End: 3000000, StatsCount: StatsCount{Count: 1, Bytes: 10}},
+	}
+	if !reflect.DeepEqual(stats.Slots, wantSlots) {
+		t.Errorf("Slots = %+v, want %+v", stats.Slots, wantSlots)
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// checksumSuffix is appended to an object's key to get its checksum sidecar,
+// which holds the digest in the format written by sha256sum
+const checksumSuffix = ".sha256"
+
+// checksumFileLimit caps the bytes read from a checksum sidecar
+const checksumFileLimit = 4096
+
+// verifyProgressInterval is the least time between two progress events of a
+// verification
+const verifyProgressInterval = time.Second
+
+// sha256Regex matches a hex-encoded SHA-256 digest
+var sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// parseChecksum returns the SHA-256 digest in a checksum, which may be
+// followed by a file name as written by sha256sum or prefixed by "sha256:"
+func parseChecksum(checksum string) (string, bool) {
+	fields := strings.Fields(checksum)
+	if len(fields) == 0 {
+		return "", false
+	}
+	digest := strings.ToLower(strings.TrimPrefix(fields[0], "sha256:"))
+	return digest, sha256Regex.MatchString(digest)
+}
+
+// progressReader counts the bytes read through it and reports them at most
+// once per verifyProgressInterval
+type progressReader struct {
+	reader io.Reader
+	read   int64
+	last   time.Time
+	report func(read int64)
+}
+
+// Read implements io.Reader
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.read += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= verifyProgressInterval {
+		p.last = now
+		p.report(p.read)
+	}
+	return n, err
+}
+
+// hashObject streams an object through SHA-256 without buffering it and
+// returns the hex digest and the number of bytes read. progress is called
+// with the bytes read so far and the object's size.
+func hashObject(ctx context.Context, store storage.ObjectStore, key string, progress func(read, total int64)) (string, int64, error) {
+	result, err := store.GetObject(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer result.Body.Close()
+
+	reader := &progressReader{
+		reader: result.Body,
+		last:   time.Now(),
+		report: func(read int64) { progress(read, result.ContentLength) },
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", reader.read, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), reader.read, nil
+}
+
+// expectedChecksum returns the published SHA-256 digest of an object and
+// where it was found: the object's .sha256 sidecar, or the sha256 field of
+// its metadata. The hash field is not used since snapshot hashes are bank
+// hashes, not file digests. It returns an empty digest if there is none.
+func (h *Handler) expectedChecksum(ctx context.Context, source *Source, key string) (string, string, error) {
+	sidecar := key + checksumSuffix
+	result, err := source.store.GetObject(ctx, sidecar)
+	switch {
+	case err == nil:
+		body, err := io.ReadAll(io.LimitReader(result.Body, checksumFileLimit))
+		result.Body.Close()
+		if err != nil {
+			return "", "", err
+		}
+		digest, ok := parseChecksum(string(body))
+		if !ok {
+			return "", "", fmt.Errorf("%s does not hold a SHA-256 digest", sidecar)
+		}
+		return digest, sidecar, nil
+	case !errors.Is(err, storage.ErrNotFound):
+		return "", "", err
+	}
+
+	metadata, ok := h.lookupMetadata(source, key)
+	if !ok {
+		return "", "", nil
+	}
+	if value, ok := metadata.ExtraValue("sha256"); ok {
+		if digest, ok := parseChecksum(value); ok {
+			return digest, "metadata", nil
+		}
+	}
+	return "", "", nil
+}
+
+// verifyObject hashes an object and compares it with its published checksum,
+// publishing its progress to the source's WebSocket clients. The result is
+// recorded on the object's catalog entry.
+func (h *Handler) verifyObject(ctx context.Context, source *Source, obj storage.Object) models.Verification {
+	event := VerifyEvent{
+		Type:       verifyEventType,
+		Source:     source.Name,
+		Key:        obj.Key,
+		State:      verifyStarted,
+		TotalBytes: obj.Size,
+	}
+	source.hub.PublishVerification(event)
+
+	verification := models.Verification{Key: obj.Key, Size: obj.Size, ETag: obj.ETag}
+
+	expected, from, err := h.expectedChecksum(ctx, source, obj.Key)
+	if err == nil {
+		verification.Expected = expected
+		verification.ExpectedFrom = from
+		verification.SHA256, verification.Size, err = hashObject(ctx, source.store, obj.Key, func(read, total int64) {
+			event.State = verifyProgress
+			event.BytesRead = read
+			event.TotalBytes = total
+			source.hub.PublishVerification(event)
+		})
+	}
+
+	switch {
+	case err != nil:
+		verification.Status = models.VerificationFailed
+		verification.Error = err.Error()
+	case expected == "":
+		verification.Status = models.VerificationNoChecksum
+	case expected == verification.SHA256:
+		verification.Status = models.VerificationVerified
+	default:
+		verification.Status = models.VerificationMismatch
+	}
+	verification.VerifiedAt = time.Now().UTC()
+
+	log.Printf("Verified %s of source %s: %s", obj.Key, source.Name, verification.Status)
+
+	source.catalog.SetVerification(obj.Key, verification)
+
+	event.State = verifyDone
+	event.BytesRead = verification.Size
+	event.Result = &verification
+	source.hub.PublishVerification(event)
+
+	return verification
+}
+
+// VerifyObject checks the SHA-256 digest of an object against its .sha256
+// sidecar or the sha256 field of its metadata. The object is verified in the
+// background with progress sent to WebSocket clients, or before responding if
+// wait=true, in which case the server's write timeout does not apply.
+func (h *Handler) VerifyObject(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	source, ok := h.requestSource(w, r)
+	if !ok {
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	obj, err := lookupObject(r.Context(), source, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Object not found")
+		return
+	}
+	if err != nil {
+		log.Printf("VerifyObject: Failed to look up %s: %v", key, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to look up object")
+		return
+	}
+
+	source.verifyLock.Lock()
+	if source.verifying[key] {
+		source.verifyLock.Unlock()
+		respondWithError(w, http.StatusConflict, "Object is already being verified")
+		return
+	}
+	source.verifying[key] = true
+	source.verifyLock.Unlock()
+
+	log.Printf("VerifyObject: Verifying %s of source %s (%d bytes)", key, source.Name, obj.Size)
+
+	run := func(ctx context.Context) models.Verification {
+		defer func() {
+			source.verifyLock.Lock()
+			delete(source.verifying, key)
+			source.verifyLock.Unlock()
+		}()
+		return h.verifyObject(ctx, source, obj)
+	}
+
+	if r.URL.Query().Get("wait") == "true" {
+		// Hashing a multi-GB snapshot outlasts the write timeout, and stops
+		// if the client goes away
+		clearWriteDeadline(w)
+		respondWithJSON(w, http.StatusOK, run(r.Context()))
+		return
+	}
+
+	// The verification outlives the request
+	go run(context.Background())
+	respondWithJSON(w, http.StatusAccepted, VerifyEvent{
+		Type:       verifyEventType,
+		Source:     source.Name,
+		Key:        key,
+		State:      verifyStarted,
+		TotalBytes: obj.Size,
+	})
+}
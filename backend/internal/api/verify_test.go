@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestParseChecksum(t *testing.T) {
+	digest := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	tests := []struct {
+		checksum string
+		want     string
+		wantOK   bool
+	}{
+		{checksum: digest, want: digest, wantOK: true},
+		{checksum: digest + "  snapshot.tar.zst\n", want: digest, wantOK: true},
+		{checksum: "sha256:9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08", want: digest, wantOK: true},
+		{checksum: testNode},
+		{checksum: ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseChecksum(tt.checksum)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("parseChecksum(%q) = %q, %v, want %q, %v", tt.checksum, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestVerifyObject(t *testing.T) {
+	sum := sha256.Sum256([]byte("archive"))
+	digest := hex.EncodeToString(sum[:])
+
+	sidecar := "node-a/snapshot-100-" + testNode
+	fromMetadata := "snapshot-200-" + testNode
+	unpublished := "snapshot-300-" + testNode
+	bankHash := "snapshot-400-" + testNode
+
+	store := storage.NewMemoryStore()
+	putObject(t, store, sidecar+".json", `{"solana_version":"1.18.1"}`)
+	putObject(t, store, sidecar+".tar.zst", "archive")
+	putObject(t, store, sidecar+".tar.zst.sha256", digest+"  snapshot-100.tar.zst\n")
+	putObject(t, store, fromMetadata+".json", `{"sha256":"`+digest+`"}`)
+	putObject(t, store, fromMetadata+".tar.zst", "tampered")
+	putObject(t, store, unpublished+".tar.zst", "archive")
+	// A hash field holds a bank hash, which is not compared with the digest
+	putObject(t, store, bankHash+".json", `{"hash":"`+digest+`"}`)
+	putObject(t, store, bankHash+".tar.zst", "tampered")
+
+	source := NewSource("mainnet", config.BackendMemory, store)
+	if _, err := source.catalog.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		key      string
+		wantCode int
+		want     models.Verification
+	}{
+		{
+			key:      sidecar + ".tar.zst",
+			wantCode: http.StatusOK,
+			want:     models.Verification{Status: models.VerificationVerified, ExpectedFrom: sidecar + ".tar.zst.sha256"},
+		},
+		{
+			key:      fromMetadata + ".tar.zst",
+			wantCode: http.StatusOK,
+			want:     models.Verification{Status: models.VerificationMismatch, ExpectedFrom: "metadata"},
+		},
+		{
+			key:      unpublished + ".tar.zst",
+			wantCode: http.StatusOK,
+			want:     models.Verification{Status: models.VerificationNoChecksum},
+		},
+		{
+			key:      bankHash + ".tar.zst",
+			wantCode: http.StatusOK,
+			want:     models.Verification{Status: models.VerificationNoChecksum},
+		},
+		{key: "missing.tar.zst", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		path := "/api/verify/" + tt.key + "?wait=true"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != tt.wantCode {
+			t.Fatalf("POST %s code = %d, want %d: %s", path, rec.Code, tt.wantCode, rec.Body.String())
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+
+		var got models.Verification
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if got.Status != tt.want.Status || got.ExpectedFrom != tt.want.ExpectedFrom || got.SHA256 == "" || got.VerifiedAt.IsZero() {
+			t.Errorf("POST %s = %+v, want status %s from %q", path, got, tt.want.Status, tt.want.ExpectedFrom)
+		}
+
+		// The result is recorded on the catalog entry
+		if metadata, ok := handler.lookupMetadata(source, tt.key); !ok || metadata.Verification == nil || metadata.Verification.Status != tt.want.Status {
+			t.Errorf("entry of %s = %+v, %v, want verification %s", tt.key, metadata, ok, tt.want.Status)
+		}
+	}
+}
+
+func TestVerifyObjectBeforeSync(t *testing.T) {
+	key := "snapshot-100-" + testNode + ".tar.zst"
+	store := storage.NewMemoryStore()
+	putObject(t, store, key, "archive")
+
+	// The catalog has not listed the store yet, so the object is looked up
+	source := NewSource("mainnet", config.BackendMemory, store)
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	for path, wantCode := range map[string]int{
+		"/api/verify/" + key + "?wait=true":     http.StatusOK,
+		"/api/verify/missing.tar.zst?wait=true": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != wantCode {
+			t.Errorf("POST %s code = %d, want %d: %s", path, rec.Code, wantCode, rec.Body.String())
+		}
+	}
+}
+
+func TestVerifyObjectEvents(t *testing.T) {
+	key := "snapshot-100-" + testNode + ".tar.zst"
+	store := storage.NewMemoryStore()
+	putObject(t, store, key, "archive")
+
+	source := NewSource("mainnet", config.BackendMemory, store)
+	if _, err := source.catalog.Sync(context.Background(), store); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	handler := NewHandler([]*Source{source}, nil, nil, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	client := &Client{hub: source.hub, send: make(chan []byte, 16)}
+	source.hub.register <- client
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/verify/"+key, nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /api/verify/%s code = %d, want %d", key, rec.Code, http.StatusAccepted)
+	}
+
+	var states []string
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case message := <-client.send:
+			var event VerifyEvent
+			if json.Unmarshal(message, &event) != nil || event.Type != verifyEventType {
+				continue
+			}
+			states = append(states, event.State)
+			if event.State != verifyDone {
+				continue
+			}
+			if states[0] != verifyStarted || event.Result == nil || event.Result.Status != models.VerificationNoChecksum || event.BytesRead != 7 {
+				t.Errorf("events = %v ending with %+v", states, event)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("verification did not finish, got events %v", states)
+		}
+	}
+}
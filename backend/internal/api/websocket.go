@@ -5,10 +5,10 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
-	"github.com/blockdaemon/s3-bucket-browser/internal/s3"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
 	"github.com/gorilla/websocket"
 )
 
@@ -22,7 +22,7 @@ const (
 	// Send pings to peer with this period
 	pingPeriod = (pongWait * 9) / 10
 
-	// Poll interval for checking new files
+	// Poll interval for syncing the catalog with the store
 	pollInterval = 10 * time.Second
 )
 
@@ -47,40 +47,33 @@ type Hub struct {
 	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
-	s3Service  *s3.Service
-	mutex      sync.Mutex
-	lastFiles  []s3.Object
+	catalog    *Catalog
 }
 
-// NewHub creates a new hub
-func NewHub(s3Service *s3.Service) *Hub {
+// NewHub creates a new hub that sends the catalog's object listing to clients
+func NewHub(catalog *Catalog) *Hub {
 	return &Hub{
 		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
-		s3Service:  s3Service,
+		catalog:    catalog,
 	}
 }
 
 // Run starts the hub
 func (h *Hub) Run(ctx context.Context) {
-	// Start polling for new files
-	go h.pollForNewFiles(ctx)
-
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
 			// Send current files to the new client
-			h.mutex.Lock()
-			if len(h.lastFiles) > 0 {
-				data, err := json.Marshal(h.lastFiles)
+			if files := h.catalog.Objects(); len(files) > 0 {
+				data, err := json.Marshal(files)
 				if err == nil {
 					client.send <- data
 				}
 			}
-			h.mutex.Unlock()
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
@@ -101,43 +94,75 @@ func (h *Hub) Run(ctx context.Context) {
 	}
 }
 
-// pollForNewFiles polls for new files
-func (h *Hub) pollForNewFiles(ctx context.Context) {
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
+// Publish broadcasts an updated object listing to all clients
+func (h *Hub) Publish(files []storage.Object) {
+	data, err := json.Marshal(files)
+	if err != nil {
+		log.Printf("Failed to marshal objects: %v", err)
+		return
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			// List objects
-			objects, err := h.s3Service.ListObjects(ctx, "")
-			if err != nil {
-				log.Printf("Failed to list objects: %v", err)
-				continue
-			}
+	h.broadcast <- data
+}
 
-			// Check if there are new files
-			h.mutex.Lock()
-			if len(objects) > len(h.lastFiles) {
-				// There are new files
-				data, err := json.Marshal(objects)
-				if err != nil {
-					log.Printf("Failed to marshal objects: %v", err)
-					h.mutex.Unlock()
-					continue
-				}
+// alertEventType is the type of the WebSocket messages that report a problem.
+// Object listings are sent as plain arrays.
+const alertEventType = "alert"
+
+// Alert is a WebSocket message reporting a problem found in a source
+type Alert struct {
+	Type     string        `json:"type"`
+	Alert    string        `json:"alert"`
+	Source   string        `json:"source"`
+	Message  string        `json:"message"`
+	Conflict *HashConflict `json:"conflict,omitempty"`
+	Mismatch *HashMismatch `json:"mismatch,omitempty"`
+}
+
+// PublishAlert broadcasts an alert to all clients
+func (h *Hub) PublishAlert(alert Alert) {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("Failed to marshal alert: %v", err)
+		return
+	}
 
-				// Broadcast to all clients
-				h.broadcast <- data
+	h.broadcast <- data
+}
 
-				// Update last files
-				h.lastFiles = objects
-			}
-			h.mutex.Unlock()
-		case <-ctx.Done():
-			return
-		}
+// verifyEventType is the type of the WebSocket messages that report the
+// progress of a verification
+const verifyEventType = "verify"
+
+// Verification states
+const (
+	verifyStarted  = "started"
+	verifyProgress = "progress"
+	verifyDone     = "done"
+)
+
+// VerifyEvent is a WebSocket message reporting the progress of verifying an
+// object. The result is set once it is done.
+type VerifyEvent struct {
+	Type       string               `json:"type"`
+	Source     string               `json:"source"`
+	Key        string               `json:"key"`
+	State      string               `json:"state"`
+	BytesRead  int64                `json:"bytes_read"`
+	TotalBytes int64                `json:"total_bytes"`
+	Result     *models.Verification `json:"result,omitempty"`
+}
+
+// PublishVerification broadcasts the progress of a verification to all
+// clients
+func (h *Hub) PublishVerification(event VerifyEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal verification event: %v", err)
+		return
 	}
+
+	h.broadcast <- data
 }
 
 // writePump pumps messages from the hub to the WebSocket connection
@@ -0,0 +1,198 @@
+// Package artifact classifies object keys into the artifact types declared in
+// the configuration and derives metadata from their names.
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// Type is a compiled artifact type
+type Type struct {
+	Name        string
+	pattern     *regexp.Regexp
+	metadataKey string
+	fields      map[string]string
+}
+
+// Registry matches keys against artifact types in order
+type Registry struct {
+	types       []*Type
+	fingerprint string
+}
+
+// Match is a key matched by an artifact type
+type Match struct {
+	Type *Type
+	// MetadataKey is the key of the artifact's sidecar metadata file, or
+	// empty if the type has none
+	MetadataKey string
+	key         string
+	submatches  []int
+}
+
+// NewRegistry compiles artifact types
+func NewRegistry(types []config.ArtifactTypeConfig) (*Registry, error) {
+	registry := &Registry{types: make([]*Type, 0, len(types))}
+	for _, cfg := range types {
+		pattern, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for artifact type %q: %w", cfg.Name, err)
+		}
+		for field := range cfg.Fields {
+			if !config.ArtifactFields[field] {
+				return nil, fmt.Errorf("unknown field %q for artifact type %q", field, cfg.Name)
+			}
+		}
+		registry.types = append(registry.types, &Type{
+			Name:        cfg.Name,
+			pattern:     pattern,
+			metadataKey: cfg.MetadataKey,
+			fields:      cfg.Fields,
+		})
+	}
+
+	data, err := json.Marshal(types)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	registry.fingerprint = hex.EncodeToString(sum[:8])
+
+	return registry, nil
+}
+
+// MustNewRegistry is like NewRegistry but panics if a type is invalid
+func MustNewRegistry(types []config.ArtifactTypeConfig) *Registry {
+	registry, err := NewRegistry(types)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// DefaultRegistry returns the registry of the default snapshot types
+func DefaultRegistry() *Registry {
+	return MustNewRegistry(config.DefaultArtifactTypes())
+}
+
+// Fingerprint identifies the configuration of the registry, so that data
+// derived from it can be rebuilt when it changes
+func (r *Registry) Fingerprint() string {
+	return r.fingerprint
+}
+
+// Types returns the names of the artifact types in order
+func (r *Registry) Types() []string {
+	names := make([]string, len(r.types))
+	for i, t := range r.types {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Match returns the first artifact type matching a key
+func (r *Registry) Match(key string) (Match, bool) {
+	for _, t := range r.types {
+		submatches := t.pattern.FindStringSubmatchIndex(key)
+		if submatches == nil {
+			continue
+		}
+
+		match := Match{Type: t, key: key, submatches: submatches}
+		if t.metadataKey != "" {
+			match.MetadataKey = match.expand(t.metadataKey)
+		}
+		return match, true
+	}
+	return Match{}, false
+}
+
+// IsMetadataFile reports whether a key is the sidecar metadata file of an
+// artifact
+func (r *Registry) IsMetadataFile(key string) bool {
+	match, ok := r.Match(key)
+	return ok && match.MetadataKey == key
+}
+
+// expand substitutes the capture groups of the match into a template
+func (m Match) expand(template string) string {
+	return string(m.Type.pattern.ExpandString(nil, template, m.key, m.submatches))
+}
+
+// Fields returns the metadata fields set by the artifact's key
+func (m Match) Fields() map[string]string {
+	fields := make(map[string]string, len(m.Type.fields))
+	for field, template := range m.Type.fields {
+		fields[field] = m.expand(template)
+	}
+	return fields
+}
+
+// HasField reports whether the artifact type sets a metadata field
+func (m Match) HasField(field string) bool {
+	_, ok := m.Type.fields[field]
+	return ok
+}
+
+// Apply sets the artifact type and the fields derived from the key on
+// metadata. Fields already set, for example from the sidecar file, are kept.
+func (m Match) Apply(metadata *models.Metadata) {
+	metadata.ArtifactType = m.Type.Name
+
+	for name, value := range m.Fields() {
+		if value == "" {
+			continue
+		}
+		switch name {
+		case "slot":
+			setInt(&metadata.Slot, value)
+		case "base_slot":
+			setInt(&metadata.BaseSlot, value)
+		case "feature_set":
+			if metadata.SolanaFeatureSet == 0 {
+				if n, err := strconv.Atoi(value); err == nil {
+					metadata.SolanaFeatureSet = n
+				}
+			}
+		case "node":
+			setString(&metadata.Node, value)
+		case "hash":
+			setString(&metadata.Hash, value)
+		case "file_hash":
+			setString(&metadata.FileHash, value)
+		case "snapshot_type":
+			setString(&metadata.SnapshotType, value)
+		case "solana_version":
+			setString(&metadata.SolanaVersion, value)
+		case "status":
+			setString(&metadata.Status, value)
+		case "uploaded_by":
+			setString(&metadata.UploadedBy, value)
+		}
+	}
+}
+
+// setString sets a field if it is empty
+func setString(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// setInt sets a numeric field from a string if it is zero
+func setInt(field *int64, value string) {
+	if *field != 0 {
+		return
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*field = n
+	}
+}
@@ -0,0 +1,172 @@
+package artifact
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+const testNode = "AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96"
+
+func TestDefaultRegistryMatch(t *testing.T) {
+	registry := DefaultRegistry()
+
+	tests := []struct {
+		name            string
+		key             string
+		wantType        string
+		wantMetadataKey string
+		want            models.Metadata
+	}{
+		{
+			name:            "snapshot metadata file",
+			key:             "snapshot-123456789-" + testNode + ".json",
+			wantType:        "snapshot",
+			wantMetadataKey: "snapshot-123456789-" + testNode + ".json",
+			want:            models.Metadata{ArtifactType: "snapshot", Slot: 123456789, Node: testNode, FileHash: testNode, SnapshotType: "full"},
+		},
+		{
+			name:            "snapshot metadata file with longer slot",
+			key:             "snapshot-9876543210-" + testNode + ".json",
+			wantType:        "snapshot",
+			wantMetadataKey: "snapshot-9876543210-" + testNode + ".json",
+			want:            models.Metadata{ArtifactType: "snapshot", Slot: 9876543210, Node: testNode, FileHash: testNode, SnapshotType: "full"},
+		},
+		{
+			name:            "zstd archive under a prefix",
+			key:             "mainnet/snapshot-123456789-" + testNode + ".tar.zst",
+			wantType:        "snapshot",
+			wantMetadataKey: "mainnet/snapshot-123456789-" + testNode + ".json",
+			want:            models.Metadata{ArtifactType: "snapshot", Slot: 123456789, Node: testNode, FileHash: testNode, SnapshotType: "full"},
+		},
+		{
+			name:            "gzip archive",
+			key:             "snapshot-123456789-" + testNode + ".tar.gz",
+			wantType:        "snapshot",
+			wantMetadataKey: "snapshot-123456789-" + testNode + ".json",
+			want:            models.Metadata{ArtifactType: "snapshot", Slot: 123456789, Node: testNode, FileHash: testNode, SnapshotType: "full"},
+		},
+		{
+			name:            "incremental archive",
+			key:             "incremental-snapshot-123456000-123456789-" + testNode + ".tar.bz2",
+			wantType:        "incremental-snapshot",
+			wantMetadataKey: "incremental-snapshot-123456000-123456789-" + testNode + ".json",
+			want: models.Metadata{
+				ArtifactType: "incremental-snapshot",
+				Slot:         123456789,
+				BaseSlot:     123456000,
+				Node:         testNode,
+				FileHash:     testNode,
+				SnapshotType: "incremental",
+			},
+		},
+		{name: "wrong format", key: "snapshot_123456789_" + testNode + ".json"},
+		{name: "no slot", key: "snapshot-" + testNode + ".json"},
+		{name: "no node", key: "snapshot-123456789.json"},
+		{name: "random json file", key: "metadata.json"},
+		{name: "unknown compression", key: "snapshot-123456789-" + testNode + ".tar.rar"},
+		{name: "other prefix", key: "old-snapshot-123456789-" + testNode + ".tar.zst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ok := registry.Match(tt.key)
+			if ok != (tt.wantType != "") {
+				t.Fatalf("Match(%q) ok = %v, want %v", tt.key, ok, tt.wantType != "")
+			}
+			if !ok {
+				return
+			}
+			if match.Type.Name != tt.wantType || match.MetadataKey != tt.wantMetadataKey {
+				t.Errorf("Match(%q) = %s with metadata key %q, want %s with %q",
+					tt.key, match.Type.Name, match.MetadataKey, tt.wantType, tt.wantMetadataKey)
+			}
+
+			var got models.Metadata
+			match.Apply(&got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() for %q = %+v, want %+v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMetadataFile(t *testing.T) {
+	registry := DefaultRegistry()
+
+	tests := map[string]bool{
+		"snapshot-123456789-" + testNode + ".json":                       true,
+		"incremental-snapshot-123456000-123456789-" + testNode + ".json": true,
+		"snapshot-123456789-" + testNode + ".tar.gz":                     false,
+		"metadata.json": false,
+	}
+	for key, want := range tests {
+		if got := registry.IsMetadataFile(key); got != want {
+			t.Errorf("IsMetadataFile(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestConfiguredTypes(t *testing.T) {
+	registry, err := NewRegistry([]config.ArtifactTypeConfig{
+		{
+			Name:        "genesis",
+			Pattern:     `^genesis-(?P<version>[0-9.]+)\.tar\.bz2$`,
+			MetadataKey: "genesis-${version}.json",
+			Fields:      map[string]string{"solana_version": "$version", "status": "published"},
+		},
+		{
+			Name:    "ledger",
+			Pattern: `^ledger/(?P<slot>\d+)\.tar$`,
+			Fields:  map[string]string{"slot": "${slot}"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	match, ok := registry.Match("genesis-1.18.2.tar.bz2")
+	if !ok || match.Type.Name != "genesis" || match.MetadataKey != "genesis-1.18.2.json" {
+		t.Fatalf("Match(genesis) = %+v, %v", match, ok)
+	}
+
+	// Fields already set by the sidecar file are kept
+	metadata := models.Metadata{Status: "verified"}
+	match.Apply(&metadata)
+	if metadata.SolanaVersion != "1.18.2" || metadata.Status != "verified" || metadata.ArtifactType != "genesis" {
+		t.Errorf("Apply() = %+v", metadata)
+	}
+
+	match, ok = registry.Match("ledger/42.tar")
+	if !ok || match.MetadataKey != "" {
+		t.Fatalf("Match(ledger) = %+v, %v, want a match without a metadata key", match, ok)
+	}
+	metadata = models.Metadata{}
+	match.Apply(&metadata)
+	if metadata.Slot != 42 {
+		t.Errorf("Apply() slot = %d, want 42", metadata.Slot)
+	}
+
+	if _, ok := registry.Match("snapshot-1-" + testNode + ".json"); ok {
+		t.Errorf("Match() matched a type that is not configured")
+	}
+	if registry.Fingerprint() == DefaultRegistry().Fingerprint() {
+		t.Errorf("Fingerprint() is the same for different types")
+	}
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	tests := map[string]config.ArtifactTypeConfig{
+		"invalid pattern": {Name: "broken", Pattern: `(`},
+		"unknown field":   {Name: "broken", Pattern: `.*`, Fields: map[string]string{"colour": "red"}},
+	}
+	for name, artifactType := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewRegistry([]config.ArtifactTypeConfig{artifactType}); err == nil {
+				t.Errorf("NewRegistry() error = nil, want an error")
+			}
+		})
+	}
+}
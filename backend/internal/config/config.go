@@ -4,14 +4,63 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/schema"
 )
 
 // Config represents the application configuration
 type Config struct {
-	S3     S3Config     `json:"s3"`
-	Redis  RedisConfig  `json:"redis"`
-	Server ServerConfig `json:"server"`
+	Storage  StorageConfig  `json:"storage"`
+	S3       S3Config       `json:"s3"`
+	Sources  []SourceConfig `json:"sources,omitempty"`
+	Redis    RedisConfig    `json:"redis"`
+	Server   ServerConfig   `json:"server"`
+	Download DownloadConfig `json:"download"`
+	Index    IndexConfig    `json:"index"`
+	Analysis AnalysisConfig `json:"analysis"`
+	// Validation configures the schema metadata files are checked against
+	Validation ValidationConfig `json:"validation"`
+	// Artifacts declares the kinds of artifacts in the bucket, matched in
+	// order; the default snapshot types are used if none are configured
+	Artifacts []ArtifactTypeConfig `json:"artifacts,omitempty"`
+}
+
+// Storage backends
+const (
+	BackendS3         = "s3"
+	BackendFileSystem = "filesystem"
+	BackendMemory     = "memory"
+)
+
+// StorageConfig selects the object store backend
+type StorageConfig struct {
+	// Backend is one of "s3" (default), "filesystem" or "memory"
+	Backend string `json:"backend"`
+	// Root is the directory served by the filesystem backend, and the
+	// directory the memory backend is seeded from if set
+	Root string `json:"root,omitempty"`
+}
+
+// DefaultSourceName is the name of the source built from the storage and s3
+// sections when no sources are configured
+const DefaultSourceName = "default"
+
+// sourceNameRegex restricts source names to characters safe in URL paths
+var sourceNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SourceConfig represents a named object store served by the application.
+// The S3 settings are inlined so a source reads like the s3 section.
+type SourceConfig struct {
+	Name string `json:"name"`
+	// Backend is one of "s3" (default), "filesystem" or "memory"
+	Backend string `json:"backend,omitempty"`
+	// Root is the directory used by the filesystem and memory backends
+	Root string `json:"root,omitempty"`
+	// Prefix limits the source to keys below this prefix
+	Prefix string `json:"prefix,omitempty"`
+	S3Config
 }
 
 // S3Config represents the S3 configuration
@@ -21,6 +70,10 @@ type S3Config struct {
 	AccessKeyID     string `json:"accessKeyId"`
 	SecretAccessKey string `json:"secretAccessKey"`
 	Endpoint        string `json:"endpoint,omitempty"`
+	// ListPageSize is the number of keys requested per list call (max 1000)
+	ListPageSize int32 `json:"listPageSize,omitempty"`
+	// MaxListObjects caps the number of objects returned by a listing (0 = unlimited)
+	MaxListObjects int `json:"maxListObjects,omitempty"`
 }
 
 // RedisConfig represents the Redis configuration
@@ -37,10 +90,107 @@ type ServerConfig struct {
 	Host string `json:"host"`
 }
 
+// DownloadConfig represents the presigned download configuration
+type DownloadConfig struct {
+	// URLExpirySeconds is the default lifetime of a presigned URL
+	URLExpirySeconds int `json:"urlExpirySeconds"`
+	// MaxURLExpirySeconds caps the lifetime a caller may request
+	MaxURLExpirySeconds int `json:"maxUrlExpirySeconds"`
+	// AllowedPatterns are regular expressions a key must match to be
+	// downloadable (empty = any key)
+	AllowedPatterns []string `json:"allowedPatterns,omitempty"`
+}
+
+// IndexConfig represents the on-disk metadata index configuration
+type IndexConfig struct {
+	// Path is the index database file (empty = no on-disk index)
+	Path string `json:"path,omitempty"`
+}
+
+// AnalysisConfig represents the thresholds of the catalog analyses
+type AnalysisConfig struct {
+	// StaleSlots is how many slots a node's latest snapshot may be behind
+	// the newest snapshot before the node is reported as stale (0 = never)
+	StaleSlots int64 `json:"staleSlots"`
+	// StaleAfterSeconds is how old a node's latest snapshot may be before
+	// the node is reported as stale (0 = never)
+	StaleAfterSeconds int `json:"staleAfterSeconds"`
+}
+
+// ValidationConfig represents the metadata validation configuration
+type ValidationConfig struct {
+	// SchemaFile is a JSON Schema every metadata file is validated against
+	// while indexing (empty = the built-in snapshot metadata schema)
+	SchemaFile string `json:"schemaFile,omitempty"`
+}
+
+// ArtifactTypeConfig declares a kind of artifact by its key naming pattern
+type ArtifactTypeConfig struct {
+	Name string `json:"name"`
+	// Pattern is a regular expression matched against object keys
+	Pattern string `json:"pattern"`
+	// MetadataKey is the key of the sidecar metadata file, with $name or
+	// ${name} references to the pattern's named capture groups. A key that
+	// is its own metadata key is a metadata file. Empty means the artifact
+	// has no sidecar.
+	MetadataKey string `json:"metadataKey,omitempty"`
+	// Fields maps metadata fields to values with the same group references
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// ArtifactFields are the metadata fields an artifact type can set from its
+// key
+var ArtifactFields = map[string]bool{
+	"slot":           true,
+	"base_slot":      true,
+	"node":           true,
+	"hash":           true,
+	"file_hash":      true,
+	"snapshot_type":  true,
+	"solana_version": true,
+	"feature_set":    true,
+	"status":         true,
+	"uploaded_by":    true,
+}
+
+// DefaultArtifactTypes returns the full and incremental Solana snapshot
+// archives and their metadata files
+func DefaultArtifactTypes() []ArtifactTypeConfig {
+	const extensions = `\.(?:json|tar(?:\.gz|\.zst|\.bz2|\.lz4)?)$`
+	return []ArtifactTypeConfig{
+		{
+			Name:        "snapshot",
+			Pattern:     `^(?P<dir>(?:.*/)?)snapshot-(?P<slot>\d+)-(?P<hash>[A-Za-z0-9]+)` + extensions,
+			MetadataKey: "${dir}snapshot-${slot}-${hash}.json",
+			Fields: map[string]string{
+				"slot":          "${slot}",
+				"node":          "${hash}",
+				"file_hash":     "${hash}",
+				"snapshot_type": "full",
+			},
+		},
+		{
+			Name:        "incremental-snapshot",
+			Pattern:     `^(?P<dir>(?:.*/)?)incremental-snapshot-(?P<base_slot>\d+)-(?P<slot>\d+)-(?P<hash>[A-Za-z0-9]+)` + extensions,
+			MetadataKey: "${dir}incremental-snapshot-${base_slot}-${slot}-${hash}.json",
+			Fields: map[string]string{
+				"slot":          "${slot}",
+				"base_slot":     "${base_slot}",
+				"node":          "${hash}",
+				"file_hash":     "${hash}",
+				"snapshot_type": "incremental",
+			},
+		},
+	}
+}
+
 // LoadConfig loads the configuration from a file and overrides with environment variables
 func LoadConfig(path string) (*Config, error) {
 	// Default configuration
 	config := Config{
+		Storage: StorageConfig{
+			Backend: BackendS3,
+		},
 		S3: S3Config{
 			Region: "us-east-1",
 		},
@@ -52,6 +202,14 @@ func LoadConfig(path string) (*Config, error) {
 			Port: 8080,
 			Host: "0.0.0.0",
 		},
+		Download: DownloadConfig{
+			URLExpirySeconds:    900,
+			MaxURLExpirySeconds: 3600,
+		},
+		Analysis: AnalysisConfig{
+			StaleSlots:        100000,
+			StaleAfterSeconds: 86400,
+		},
 	}
 
 	// Load from file if it exists
@@ -72,6 +230,14 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	// Override with environment variables
+	if backend := os.Getenv("STORAGE_BACKEND"); backend != "" {
+		config.Storage.Backend = backend
+	}
+
+	if root := os.Getenv("STORAGE_ROOT"); root != "" {
+		config.Storage.Root = root
+	}
+
 	if region := os.Getenv("S3_REGION"); region != "" {
 		config.S3.Region = region
 	}
@@ -92,6 +258,18 @@ func LoadConfig(path string) (*Config, error) {
 		config.S3.Endpoint = endpoint
 	}
 
+	if pageSize := os.Getenv("S3_LIST_PAGE_SIZE"); pageSize != "" {
+		if size, err := strconv.ParseInt(pageSize, 10, 32); err == nil {
+			config.S3.ListPageSize = int32(size)
+		}
+	}
+
+	if maxObjects := os.Getenv("S3_MAX_LIST_OBJECTS"); maxObjects != "" {
+		if limit, err := strconv.Atoi(maxObjects); err == nil {
+			config.S3.MaxListObjects = limit
+		}
+	}
+
 	if redisHost := os.Getenv("REDIS_HOST"); redisHost != "" {
 		config.Redis.Host = redisHost
 	}
@@ -122,9 +300,87 @@ func LoadConfig(path string) (*Config, error) {
 		config.Server.Host = serverHost
 	}
 
+	if expiry := os.Getenv("DOWNLOAD_URL_EXPIRY_SECONDS"); expiry != "" {
+		if seconds, err := strconv.Atoi(expiry); err == nil {
+			config.Download.URLExpirySeconds = seconds
+		}
+	}
+
+	if indexPath := os.Getenv("INDEX_PATH"); indexPath != "" {
+		config.Index.Path = indexPath
+	}
+
+	if schemaFile := os.Getenv("METADATA_SCHEMA_FILE"); schemaFile != "" {
+		config.Validation.SchemaFile = schemaFile
+	}
+
+	// Without a list of sources, serve the single storage/s3 configuration
+	if len(config.Sources) == 0 {
+		config.Sources = []SourceConfig{{
+			Name:     DefaultSourceName,
+			Backend:  config.Storage.Backend,
+			Root:     config.Storage.Root,
+			S3Config: config.S3,
+		}}
+	}
+
 	// Validate required configuration
-	if config.S3.Bucket == "" {
-		return nil, fmt.Errorf("S3 bucket name is required")
+	names := make(map[string]bool)
+	for i := range config.Sources {
+		source := &config.Sources[i]
+		if !sourceNameRegex.MatchString(source.Name) {
+			return nil, fmt.Errorf("invalid source name %q", source.Name)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("duplicate source name %q", source.Name)
+		}
+		names[source.Name] = true
+
+		if source.Backend == "" {
+			source.Backend = BackendS3
+		}
+		if source.Region == "" {
+			source.Region = config.S3.Region
+		}
+
+		switch source.Backend {
+		case BackendS3:
+			if source.Bucket == "" {
+				return nil, fmt.Errorf("S3 bucket name is required for source %q", source.Name)
+			}
+		case BackendFileSystem:
+			if source.Root == "" {
+				return nil, fmt.Errorf("storage root is required for the filesystem backend of source %q", source.Name)
+			}
+		case BackendMemory:
+		default:
+			return nil, fmt.Errorf("unknown storage backend %q for source %q", source.Backend, source.Name)
+		}
+	}
+
+	if len(config.Artifacts) == 0 {
+		config.Artifacts = DefaultArtifactTypes()
+	}
+	if err := validateArtifactTypes(config.Artifacts); err != nil {
+		return nil, err
+	}
+
+	if _, err := schema.Load(config.Validation.SchemaFile); err != nil {
+		return nil, fmt.Errorf("invalid metadata schema: %w", err)
+	}
+
+	if config.Download.URLExpirySeconds <= 0 {
+		return nil, fmt.Errorf("download URL expiry must be positive")
+	}
+
+	if config.Download.MaxURLExpirySeconds < config.Download.URLExpirySeconds {
+		config.Download.MaxURLExpirySeconds = config.Download.URLExpirySeconds
+	}
+
+	for _, pattern := range config.Download.AllowedPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid download pattern %q: %w", pattern, err)
+		}
 	}
 
 	return &config, nil
@@ -134,3 +390,28 @@ func LoadConfig(path string) (*Config, error) {
 func (r *RedisConfig) Address() string {
 	return fmt.Sprintf("%s:%d", r.Host, r.Port)
 }
+
+// validateArtifactTypes checks the names, patterns and fields of artifact
+// types
+func validateArtifactTypes(types []ArtifactTypeConfig) error {
+	names := make(map[string]bool)
+	for _, artifactType := range types {
+		if !sourceNameRegex.MatchString(artifactType.Name) {
+			return fmt.Errorf("invalid artifact type name %q", artifactType.Name)
+		}
+		if names[artifactType.Name] {
+			return fmt.Errorf("duplicate artifact type name %q", artifactType.Name)
+		}
+		names[artifactType.Name] = true
+
+		if _, err := regexp.Compile(artifactType.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern for artifact type %q: %w", artifactType.Name, err)
+		}
+		for field := range artifactType.Fields {
+			if !ArtifactFields[field] {
+				return fmt.Errorf("unknown field %q for artifact type %q", field, artifactType.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/schema"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Each source gets a top-level bucket holding these nested buckets
+var (
+	objectsBucket  = []byte("objects")
+	metadataBucket = []byte("metadata")
+	stateBucket    = []byte("state")
+	stateKey       = []byte("state")
+)
+
+// Entry is a parsed metadata file and the ETag it was parsed from
+type Entry struct {
+	ETag     string          `json:"etag"`
+	Metadata models.Metadata `json:"metadata"`
+}
+
+// State is the sync state of a source
+type State struct {
+	SyncedAt time.Time `json:"synced_at"`
+	// ParserVersion identifies the metadata parser that produced the stored
+	// entries, so they can be rebuilt when parsing changes
+	ParserVersion int `json:"parser_version"`
+	// ArtifactTypes is the fingerprint of the artifact types the entries were
+	// built with
+	ArtifactTypes string `json:"artifact_types"`
+	// Schema is the fingerprint of the schema the metadata files were
+	// validated against
+	Schema string `json:"schema"`
+	// Invalid maps the keys of metadata files that could not be parsed to
+	// their ETag, so they are not fetched again until they change
+	Invalid map[string]string `json:"invalid"`
+	// Problems maps the keys of metadata files that do not conform to the
+	// schema, including the invalid ones, to their problems
+	Problems map[string][]schema.Problem `json:"problems,omitempty"`
+}
+
+// Snapshot is everything stored for a source
+type Snapshot struct {
+	Objects []storage.Object
+	Entries map[string]Entry
+	State   State
+}
+
+// Change describes the result of a sync to be written for a source
+type Change struct {
+	// Objects replaces the stored listing if not nil
+	Objects []storage.Object
+	// Reset drops all stored metadata entries before applying Put and Delete
+	Reset  bool
+	Put    map[string]Entry
+	Delete []string
+	State  State
+}
+
+// DB is an on-disk index of the catalogs of all sources
+type DB struct {
+	db *bolt.DB
+}
+
+// Open opens the index at path, creating it if needed
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index %s: %w", path, err)
+	}
+
+	return &DB{db: db}, nil
+}
+
+// Close closes the index
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Load reads everything stored for a source. It returns nil if nothing has
+// been stored yet. Buckets that are missing, as when an entry was written by
+// PutEntry before the first sync, are read as empty.
+func (d *DB) Load(source string) (*Snapshot, error) {
+	var snapshot *Snapshot
+	err := d.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(source))
+		if root == nil {
+			return nil
+		}
+
+		snapshot = &Snapshot{
+			Objects: []storage.Object{},
+			Entries: make(map[string]Entry),
+		}
+
+		if bucket := root.Bucket(stateBucket); bucket != nil {
+			if state := bucket.Get(stateKey); state != nil {
+				if err := json.Unmarshal(state, &snapshot.State); err != nil {
+					return fmt.Errorf("invalid state: %w", err)
+				}
+			}
+		}
+
+		// Objects are stored by key, so the cursor returns them in key order
+		err := forEach(root, objectsBucket, func(k, v []byte) error {
+			var obj storage.Object
+			if err := json.Unmarshal(v, &obj); err != nil {
+				return fmt.Errorf("invalid object %s: %w", k, err)
+			}
+			snapshot.Objects = append(snapshot.Objects, obj)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return forEach(root, metadataBucket, func(k, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("invalid metadata entry %s: %w", k, err)
+			}
+			snapshot.Entries[string(k)] = entry
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index of source %s: %w", source, err)
+	}
+
+	return snapshot, nil
+}
+
+// Update writes the result of a sync for a source in a single transaction
+func (d *DB) Update(source string, change *Change) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(source))
+		if err != nil {
+			return err
+		}
+
+		if change.Objects != nil {
+			// Rewrite the listing from scratch
+			if root.Bucket(objectsBucket) != nil {
+				if err := root.DeleteBucket(objectsBucket); err != nil {
+					return err
+				}
+			}
+			objects, err := root.CreateBucket(objectsBucket)
+			if err != nil {
+				return err
+			}
+			for _, obj := range change.Objects {
+				if err := putJSON(objects, []byte(obj.Key), obj); err != nil {
+					return err
+				}
+			}
+		} else if _, err := root.CreateBucketIfNotExists(objectsBucket); err != nil {
+			return err
+		}
+
+		if change.Reset && root.Bucket(metadataBucket) != nil {
+			if err := root.DeleteBucket(metadataBucket); err != nil {
+				return err
+			}
+		}
+		metadata, err := root.CreateBucketIfNotExists(metadataBucket)
+		if err != nil {
+			return err
+		}
+		for key, entry := range change.Put {
+			if err := putJSON(metadata, []byte(key), entry); err != nil {
+				return err
+			}
+		}
+		for _, key := range change.Delete {
+			if err := metadata.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		state, err := root.CreateBucketIfNotExists(stateBucket)
+		if err != nil {
+			return err
+		}
+		return putJSON(state, stateKey, change.State)
+	})
+}
+
+// PutEntry writes a single metadata entry of a source outside of a sync
+func (d *DB) PutEntry(source, key string, entry Entry) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(source))
+		if err != nil {
+			return err
+		}
+		metadata, err := root.CreateBucketIfNotExists(metadataBucket)
+		if err != nil {
+			return err
+		}
+		return putJSON(metadata, []byte(key), entry)
+	})
+}
+
+// forEach calls fn for every key of a sub-bucket, if it exists
+func forEach(root *bolt.Bucket, name []byte, fn func(k, v []byte) error) error {
+	bucket := root.Bucket(name)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(fn)
+}
+
+// putJSON stores a value as JSON
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(key, data)
+}
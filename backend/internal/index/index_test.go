@@ -0,0 +1,103 @@
+package index
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+func TestUpdateAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "index.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if snapshot, err := db.Load("mainnet"); err != nil || snapshot != nil {
+		t.Fatalf("Load() on an empty index = %+v, %v, want nil", snapshot, err)
+	}
+
+	syncedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	err = db.Update("mainnet", &Change{
+		Objects: []storage.Object{
+			storage.NewObject("b.json", 2, syncedAt, `"b"`),
+			storage.NewObject("a.json", 1, syncedAt, `"a"`),
+		},
+		Put: map[string]Entry{
+			"a.json": {ETag: `"a"`, Metadata: models.Metadata{FileName: "a.json", Slot: 100}},
+			"b.json": {ETag: `"b"`, Metadata: models.Metadata{FileName: "b.json", Slot: 200}},
+		},
+		State: State{SyncedAt: syncedAt, Invalid: map[string]string{"c.json": `"c"`}},
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// Later syncs only carry what changed
+	err = db.Update("mainnet", &Change{
+		Delete: []string{"b.json"},
+		State:  State{SyncedAt: syncedAt.Add(time.Minute)},
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// Entries can also be written outside of a sync
+	verified := models.Metadata{FileName: "a.json", Slot: 100, Verification: &models.Verification{Key: "a.tar.zst", Status: models.VerificationVerified}}
+	if err := db.PutEntry("mainnet", "a.json", Entry{ETag: `"a"`, Metadata: verified}); err != nil {
+		t.Fatalf("PutEntry() error = %v", err)
+	}
+
+	// Reopen to make sure everything made it to disk
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	snapshot, err := db.Load("mainnet")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(snapshot.Objects) != 2 || snapshot.Objects[0].Key != "a.json" || !snapshot.Objects[0].IsMetadata {
+		t.Errorf("Load() objects = %+v, want a.json and b.json in key order", snapshot.Objects)
+	}
+	if len(snapshot.Entries) != 1 || snapshot.Entries["a.json"].Metadata.Slot != 100 || snapshot.Entries["a.json"].Metadata.Verification == nil {
+		t.Errorf("Load() entries = %+v, want only a.json with its verification", snapshot.Entries)
+	}
+	if !snapshot.State.SyncedAt.Equal(syncedAt.Add(time.Minute)) {
+		t.Errorf("Load() synced at = %v, want %v", snapshot.State.SyncedAt, syncedAt.Add(time.Minute))
+	}
+
+	if other, err := db.Load("testnet"); err != nil || other != nil {
+		t.Errorf("Load() of another source = %+v, %v, want nil", other, err)
+	}
+}
+
+func TestPutEntryBeforeSync(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// A verification can be recorded before the source's first sync is stored
+	verified := models.Metadata{FileName: "a.json", Verification: &models.Verification{Key: "a.tar.zst", Status: models.VerificationVerified}}
+	if err := db.PutEntry("mainnet", "a.json", Entry{ETag: `"a"`, Metadata: verified}); err != nil {
+		t.Fatalf("PutEntry() error = %v", err)
+	}
+
+	snapshot, err := db.Load("mainnet")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(snapshot.Objects) != 0 || len(snapshot.Entries) != 1 || snapshot.State.ParserVersion != 0 {
+		t.Errorf("Load() = %+v, want only the a.json entry", snapshot)
+	}
+}
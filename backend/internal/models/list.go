@@ -0,0 +1,15 @@
+package models
+
+// List is one page of a listing. Next and Prev are opaque cursors to the
+// adjacent pages and are empty at either end; Page is only set when the page
+// was requested by number. Partial is set when the listing the page was cut
+// from is incomplete.
+type List[T any] struct {
+	Items    []T    `json:"items"`
+	Total    int    `json:"total"`
+	Page     int    `json:"page,omitempty"`
+	PageSize int    `json:"page_size"`
+	Next     string `json:"next,omitempty"`
+	Prev     string `json:"prev,omitempty"`
+	Partial  bool   `json:"partial,omitempty"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
 
 // Metadata represents the metadata for a .tar.gz file
 type Metadata struct {
@@ -13,20 +17,96 @@ type Metadata struct {
 	UploadedBy       string    `json:"uploaded_by"`
 	UploadedAt       time.Time `json:"uploaded_at"`
 	FileSize         int64     `json:"file_size"`
-	FileName         string    `json:"file_name"`
-	Node             string    `json:"node,omitempty"`
-	SlotRange        string    `json:"slot_range,omitempty"`
-	// Additional fields can be added as needed
+	// FileSizeDeclared is set if FileSize comes from the metadata file. An
+	// entry parsed from a metadata file without file_size has no FileSize; an
+	// archive without a metadata file has its own size.
+	FileSizeDeclared bool   `json:"file_size_declared,omitempty"`
+	FileName         string `json:"file_name"`
+	Node             string `json:"node,omitempty"`
+	// FileHash is the hash segment of the artifact's file name, which the
+	// hash field of its metadata file should agree with
+	FileHash     string `json:"file_hash,omitempty"`
+	SlotRange    string `json:"slot_range,omitempty"`
+	SnapshotType string `json:"snapshot_type,omitempty"`
+	BaseSlot     int64  `json:"base_slot,omitempty"`
+	ArtifactType string `json:"artifact_type,omitempty"`
+	// Extra holds the fields of the metadata file that have no field above
+	Extra map[string]interface{} `json:"extra,omitempty"`
+	// Verification is the result of the last integrity check of the
+	// artifact, kept until its metadata file changes
+	Verification *Verification `json:"verification,omitempty"`
 }
 
-// MetadataList represents a list of metadata with pagination
-type MetadataList struct {
-	Items      []Metadata `json:"items"`
-	TotalCount int        `json:"total_count"`
-	Page       int        `json:"page"`
-	PageSize   int        `json:"page_size"`
+// Producer returns who produced an artifact: the uploader recorded in its
+// metadata file, or its node field unless that is only the hash segment of
+// its file name, as with the default snapshot types. It is empty if the
+// producer is unknown.
+func (m Metadata) Producer() string {
+	if m.UploadedBy != "" {
+		return m.UploadedBy
+	}
+	if m.Node == m.FileHash {
+		return ""
+	}
+	return m.Node
+}
+
+// ExtraValue returns an extra field as text: strings as they are and other
+// values in their JSON form
+func (m Metadata) ExtraValue(key string) (string, bool) {
+	value, ok := m.Extra[key]
+	if !ok || value == nil {
+		return "", false
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Verification statuses
+const (
+	VerificationVerified   = "verified"
+	VerificationMismatch   = "mismatch"
+	VerificationNoChecksum = "no_checksum"
+	VerificationFailed     = "failed"
+)
+
+// Verification is the result of checking an object's SHA-256 digest against
+// its published checksum
+type Verification struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Expected is the published checksum and ExpectedFrom where it was
+	// found: a .sha256 sidecar key or "metadata"
+	Expected     string    `json:"expected,omitempty"`
+	ExpectedFrom string    `json:"expected_from,omitempty"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	VerifiedAt   time.Time `json:"verified_at"`
+	Error        string    `json:"error,omitempty"`
 }
 
+// Snapshot types
+const (
+	SnapshotTypeFull        = "full"
+	SnapshotTypeIncremental = "incremental"
+)
+
+// MetadataList represents a list of metadata with pagination
+type MetadataList = List[Metadata]
+
 // MetadataFilter represents a filter for metadata
 type MetadataFilter struct {
 	SolanaVersion    string    `json:"solana_version"`
@@ -35,11 +115,16 @@ type MetadataFilter struct {
 	UploadedBy       string    `json:"uploaded_by"`
 	Node             string    `json:"node"`
 	SlotRange        string    `json:"slot_range"`
+	SnapshotType     string    `json:"snapshot_type"`
+	ArtifactType     string    `json:"artifact_type"`
+	BaseSlot         int64     `json:"base_slot"`
 	StartTime        time.Time `json:"start_time"`
 	EndTime          time.Time `json:"end_time"`
 	MinSlot          int64     `json:"min_slot"`
 	MaxSlot          int64     `json:"max_slot"`
 	SearchTerm       string    `json:"search_term"`
-	Page             int       `json:"page"`
-	PageSize         int       `json:"page_size"`
+	// Extra requires extra fields to have the given values
+	Extra    map[string]string `json:"extra,omitempty"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
 }
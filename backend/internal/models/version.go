@@ -0,0 +1,30 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two Solana versions semantically, returning -1, 0
+// or 1. Major, minor and patch are compared numerically; versions that do not
+// parse fall back to string comparison.
+func CompareVersions(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := 0; i < 3 && i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		if errA != nil || errB != nil {
+			break
+		}
+		if numA < numB {
+			return -1
+		}
+		if numA > numB {
+			return 1
+		}
+	}
+
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,98 @@
+package query
+
+import (
+	"strings"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// fieldKind determines how a field's values are compared
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindVersion
+	kindInt
+	kindTime
+)
+
+// field is a queryable metadata field
+type field struct {
+	name        string
+	kind        fieldKind
+	stringValue func(models.Metadata) string
+	intValue    func(models.Metadata) int64
+	timeValue   func(models.Metadata) time.Time
+}
+
+// stringField creates a text field
+func stringField(name string, value func(models.Metadata) string) *field {
+	return &field{name: name, kind: kindString, stringValue: value}
+}
+
+// intField creates a numeric field
+func intField(name string, value func(models.Metadata) int64) *field {
+	return &field{name: name, kind: kindInt, intValue: value}
+}
+
+// timeField creates a time field
+func timeField(name string, value func(models.Metadata) time.Time) *field {
+	return &field{name: name, kind: kindTime, timeValue: value}
+}
+
+// fields maps field names and their aliases to fields
+var fields = map[string]*field{}
+
+func init() {
+	version := &field{
+		name:        "version",
+		kind:        kindVersion,
+		stringValue: func(m models.Metadata) string { return m.SolanaVersion },
+	}
+	featureSet := intField("feature_set", func(m models.Metadata) int64 { return int64(m.SolanaFeatureSet) })
+	uploadedBy := stringField("uploaded_by", func(m models.Metadata) string { return m.UploadedBy })
+	fileName := stringField("file", func(m models.Metadata) string { return m.FileName })
+	fileSize := intField("file_size", func(m models.Metadata) int64 { return m.FileSize })
+
+	register(version, "solana_version")
+	register(featureSet, "solana_feature_set")
+	register(intField("slot", func(m models.Metadata) int64 { return m.Slot }))
+	register(stringField("status", func(m models.Metadata) string { return m.Status }))
+	register(uploadedBy, "uploader")
+	register(stringField("node", func(m models.Metadata) string { return m.Node }))
+	register(stringField("hash", func(m models.Metadata) string { return m.Hash }))
+	register(fileName, "file_name")
+	register(fileSize, "size")
+	register(stringField("slot_range", func(m models.Metadata) string { return m.SlotRange }))
+	register(stringField("snapshot_type", func(m models.Metadata) string { return m.SnapshotType }), "type")
+	register(intField("base_slot", func(m models.Metadata) int64 { return m.BaseSlot }))
+	register(stringField("artifact_type", func(m models.Metadata) string { return m.ArtifactType }), "artifact")
+	register(timeField("timestamp", func(m models.Metadata) time.Time { return m.Timestamp }))
+	register(timeField("uploaded_at", func(m models.Metadata) time.Time { return m.UploadedAt }))
+}
+
+// register adds a field under its name and any aliases
+func register(f *field, aliases ...string) {
+	fields[f.name] = f
+	for _, alias := range aliases {
+		fields[alias] = f
+	}
+}
+
+// extraPrefix prefixes the names of fields that query the extra fields of a
+// metadata file, as in extra.region:eu
+const extraPrefix = "extra."
+
+// lookupField returns the field of a field:value term. Extra fields keep the
+// case of their key.
+func lookupField(name string) (*field, bool) {
+	if key, ok := strings.CutPrefix(name, extraPrefix); ok && key != "" {
+		return stringField(name, func(m models.Metadata) string {
+			value, _ := m.ExtraValue(key)
+			return value
+		}), true
+	}
+	f, ok := fields[strings.ToLower(name)]
+	return f, ok
+}
@@ -0,0 +1,341 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenKind identifies a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenMinus
+)
+
+// token is a lexical token and the byte range it covers in the query
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	end  int
+}
+
+// describe returns a human readable description of the token for errors
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenLParen:
+		return `"("`
+	case tokenRParen:
+		return `")"`
+	case tokenMinus:
+		return `"-"`
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// fieldNameRegex matches the field prefix of a field:value term
+var fieldNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// Parse parses a query. An empty query matches everything.
+func Parse(input string) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return &Query{}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &Error{Pos: tok.pos, Msg: "unexpected " + tok.describe()}
+	}
+	return &Query{root: root}, nil
+}
+
+// lex splits a query into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i, end: i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i, end: i + 1})
+			i++
+		case c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(input) {
+					return nil, &Error{Pos: start, Msg: "unterminated quoted string"}
+				}
+				if input[i] == '\\' && i+1 < len(input) {
+					sb.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if input[i] == '"' {
+					i++
+					break
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start, end: i})
+		case c == '-' && i+1 < len(input) && !strings.ContainsRune(" \t\n\r)", rune(input[i+1])):
+			tokens = append(tokens, token{kind: tokenMinus, pos: i, end: i + 1})
+			i++
+		default:
+			start := i
+			for i < len(input) && !strings.ContainsRune(" \t\n\r()\"", rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: input[start:i], pos: start, end: i})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(input), end: len(input)}), nil
+}
+
+// parser is a recursive descent parser over the query tokens
+type parser struct {
+	tokens []token
+	pos    int
+	// field is set while parsing a field:( ... ) group, binding bare values
+	// to that field
+	field *field
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeyword reports whether the next token is the given operator keyword
+func (p *parser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && tok.text == keyword
+}
+
+// parseOr parses: and ("OR" and)*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: unary (["AND"] unary)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind == tokenEOF || tok.kind == tokenRParen || p.isKeyword("OR") {
+			return left, nil
+		}
+		if p.isKeyword("AND") {
+			p.next()
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+}
+
+// parseUnary parses: ("NOT" | "-") unary | primary
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().kind == tokenMinus || p.isKeyword("NOT") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: "(" or ")" | term
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenLParen:
+		return p.parseGroup(tok)
+	case tokenString:
+		if p.field != nil {
+			return p.parseValue(p.field, tok.text, tok.pos, true)
+		}
+		return &textNode{text: strings.ToLower(tok.text)}, nil
+	case tokenWord:
+		if tok.text == "AND" || tok.text == "OR" {
+			return nil, &Error{Pos: tok.pos, Msg: "unexpected " + tok.describe()}
+		}
+		return p.parseTerm(tok)
+	}
+	return nil, &Error{Pos: tok.pos, Msg: "unexpected " + tok.describe()}
+}
+
+// parseGroup parses the rest of a parenthesized expression
+func (p *parser) parseGroup(open token) (node, error) {
+	if p.peek().kind == tokenRParen {
+		return nil, &Error{Pos: p.peek().pos, Msg: "empty group"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok.kind != tokenRParen {
+		return nil, &Error{Pos: open.pos, Msg: "unclosed group"}
+	}
+	return n, nil
+}
+
+// parseTerm parses a bare word or a field:value term
+func (p *parser) parseTerm(tok token) (node, error) {
+	colon := strings.IndexByte(tok.text, ':')
+	if colon <= 0 || !fieldNameRegex.MatchString(tok.text[:colon]) {
+		if p.field != nil {
+			return p.parseValue(p.field, tok.text, tok.pos, false)
+		}
+		return &textNode{text: strings.ToLower(tok.text)}, nil
+	}
+
+	name := tok.text[:colon]
+	f, ok := lookupField(name)
+	if !ok {
+		name = strings.ToLower(name)
+		return nil, &Error{Pos: tok.pos, Msg: fmt.Sprintf("unknown field %q", name)}
+	}
+
+	value := tok.text[colon+1:]
+	valuePos := tok.pos + colon + 1
+	op, rest := splitOperator(value)
+	if rest != "" {
+		return p.parseValue(f, value, valuePos, false)
+	}
+
+	// The value directly follows the colon (or operator) as a quoted
+	// string or, for plain field:( ... ), a group of values
+	next := p.peek()
+	if next.pos != tok.end {
+		return nil, &Error{Pos: valuePos, Msg: fmt.Sprintf("missing value for field %q", name)}
+	}
+	switch {
+	case next.kind == tokenString:
+		p.next()
+		return p.parseValue(f, op+next.text, next.pos, true)
+	case next.kind == tokenLParen && op == "":
+		p.next()
+		outer := p.field
+		p.field = f
+		n, err := p.parseGroup(next)
+		p.field = outer
+		return n, err
+	}
+	return nil, &Error{Pos: valuePos, Msg: fmt.Sprintf("missing value for field %q", name)}
+}
+
+// splitOperator splits a leading comparison operator off a value
+func splitOperator(value string) (string, string) {
+	for _, op := range []string{opGreaterEqual, opLessEqual, opGreater, opLess} {
+		if strings.HasPrefix(value, op) {
+			return op, value[len(op):]
+		}
+	}
+	return "", value
+}
+
+// parseValue builds the comparison of a field against a value. Quoted values
+// are matched literally, without wildcards.
+func (p *parser) parseValue(f *field, value string, pos int, quoted bool) (node, error) {
+	op, raw := splitOperator(value)
+	valuePos := pos + len(op)
+	if op == "" {
+		op = opEqual
+	}
+	if raw == "" {
+		return nil, &Error{Pos: valuePos, Msg: fmt.Sprintf("missing value for field %q", f.name)}
+	}
+
+	n := &fieldNode{field: f, op: op, raw: raw}
+	wildcard := !quoted && strings.ContainsAny(raw, "*?")
+
+	switch f.kind {
+	case kindInt:
+		number, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, &Error{Pos: valuePos, Msg: fmt.Sprintf("field %q expects a number, got %q", f.name, raw)}
+		}
+		n.number = number
+	case kindTime:
+		start, end, err := parseTime(raw)
+		if err != nil {
+			return nil, &Error{Pos: valuePos, Msg: fmt.Sprintf("field %q expects an RFC3339 time or a YYYY-MM-DD date, got %q", f.name, raw)}
+		}
+		n.start, n.end = start, end
+	default:
+		if wildcard {
+			if op != opEqual {
+				return nil, &Error{Pos: valuePos, Msg: "wildcards cannot be combined with comparisons"}
+			}
+			n.pattern = globPattern(raw)
+		}
+		n.text = raw
+	}
+	return n, nil
+}
+
+// parseTime parses a time value into the half-open range it covers: a single
+// instant for RFC3339 times or a whole UTC day for dates
+func parseTime(value string) (time.Time, time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t.Add(time.Nanosecond), nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return day, day.AddDate(0, 0, 1), nil
+}
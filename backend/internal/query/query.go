@@ -0,0 +1,228 @@
+// Package query implements the metadata search language used by the q=
+// parameter. A query is a boolean expression of terms:
+//
+//	field:value          field equals value (case insensitive)
+//	field:>=value        comparison (>, >=, <, <=) on numbers, times and versions
+//	field:1.18.*         wildcard match (* and ?)
+//	field:"a phrase"     quoted value
+//	field:(a OR b)       group of values for one field
+//	extra.key:value      a field of the metadata file that has no field of its own
+//	word, "a phrase"     substring search across all text fields
+//	-term, NOT term      negation
+//	a b, a AND b         conjunction
+//	a OR b               disjunction
+//	( ... )              grouping
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+// Error is a query syntax error at a byte offset in the query
+type Error struct {
+	Pos int
+	Msg string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos, e.Msg)
+}
+
+// Query is a parsed query. A nil Query matches everything.
+type Query struct {
+	root node
+}
+
+// Match reports whether metadata matches the query
+func (q *Query) Match(metadata models.Metadata) bool {
+	if q == nil || q.root == nil {
+		return true
+	}
+	return q.root.match(metadata)
+}
+
+// String returns the parsed query in a normalized, fully parenthesized form
+func (q *Query) String() string {
+	if q == nil || q.root == nil {
+		return ""
+	}
+	return q.root.String()
+}
+
+// node is a node of the query syntax tree
+type node interface {
+	match(metadata models.Metadata) bool
+	String() string
+}
+
+// andNode matches if both sides match
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) match(metadata models.Metadata) bool {
+	return n.left.match(metadata) && n.right.match(metadata)
+}
+
+func (n *andNode) String() string {
+	return "(" + n.left.String() + " AND " + n.right.String() + ")"
+}
+
+// orNode matches if either side matches
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) match(metadata models.Metadata) bool {
+	return n.left.match(metadata) || n.right.match(metadata)
+}
+
+func (n *orNode) String() string {
+	return "(" + n.left.String() + " OR " + n.right.String() + ")"
+}
+
+// notNode matches if its operand does not
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) match(metadata models.Metadata) bool {
+	return !n.operand.match(metadata)
+}
+
+func (n *notNode) String() string {
+	return "NOT " + n.operand.String()
+}
+
+// textNode matches a substring of any text field
+type textNode struct {
+	text string
+}
+
+func (n *textNode) match(metadata models.Metadata) bool {
+	for _, value := range []string{
+		metadata.SolanaVersion,
+		metadata.Status,
+		metadata.UploadedBy,
+		metadata.Node,
+		metadata.Hash,
+		metadata.FileName,
+	} {
+		if strings.Contains(strings.ToLower(value), n.text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *textNode) String() string {
+	return fmt.Sprintf("%q", n.text)
+}
+
+// Comparison operators
+const (
+	opEqual        = ":"
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opLess         = "<"
+	opLessEqual    = "<="
+)
+
+// fieldNode compares a field against a value
+type fieldNode struct {
+	field   *field
+	op      string
+	raw     string
+	text    string
+	pattern *regexp.Regexp
+	number  int64
+	start   time.Time
+	end     time.Time
+}
+
+func (n *fieldNode) match(metadata models.Metadata) bool {
+	switch n.field.kind {
+	case kindInt:
+		return compareResult(n.op, compareInts(n.field.intValue(metadata), n.number))
+	case kindTime:
+		value := n.field.timeValue(metadata)
+		if value.IsZero() {
+			return false
+		}
+		switch n.op {
+		case opEqual:
+			return !value.Before(n.start) && value.Before(n.end)
+		case opGreater:
+			return !value.Before(n.end)
+		case opGreaterEqual:
+			return !value.Before(n.start)
+		case opLess:
+			return value.Before(n.start)
+		case opLessEqual:
+			return value.Before(n.end)
+		}
+		return false
+	}
+
+	value := n.field.stringValue(metadata)
+	if n.pattern != nil {
+		return n.pattern.MatchString(value)
+	}
+	if n.op == opEqual {
+		return strings.EqualFold(value, n.text)
+	}
+	if n.field.kind == kindVersion {
+		return compareResult(n.op, models.CompareVersions(value, n.text))
+	}
+	return compareResult(n.op, strings.Compare(strings.ToLower(value), strings.ToLower(n.text)))
+}
+
+func (n *fieldNode) String() string {
+	op := n.op
+	if op != opEqual {
+		op = ":" + op
+	}
+	return n.field.name + op + fmt.Sprintf("%q", n.raw)
+}
+
+// compareInts compares two integers, returning -1, 0 or 1
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareResult applies an operator to the result of a comparison
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case opEqual:
+		return cmp == 0
+	case opGreater:
+		return cmp > 0
+	case opGreaterEqual:
+		return cmp >= 0
+	case opLess:
+		return cmp < 0
+	case opLessEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+// globPattern compiles a case-insensitive wildcard pattern using * and ?
+func globPattern(value string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(value)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	return regexp.MustCompile("(?i)^" + pattern + "$")
+}
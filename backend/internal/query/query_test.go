@@ -0,0 +1,141 @@
+package query
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blockdaemon/s3-bucket-browser/internal/models"
+)
+
+var testMetadata = []models.Metadata{
+	{
+		FileName:         "snapshot-250000100-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
+		SolanaVersion:    "1.18.9",
+		SolanaFeatureSet: 3469865029,
+		Slot:             250000100,
+		Status:           "ok",
+		Node:             "AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96",
+		UploadedBy:       "uploader-eu",
+		Timestamp:        time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Extra:            map[string]interface{}{"region": "eu"},
+	},
+	{
+		FileName:      "snapshot-249000000-BeTc1kgzVJgM4v9uS9q6RQkTZqy6WqNTNC1sXUpvVHVt.json",
+		SolanaVersion: "1.18.10",
+		Slot:          249000000,
+		Status:        "verified",
+		Node:          "BeTc1kgzVJgM4v9uS9q6RQkTZqy6WqNTNC1sXUpvVHVt",
+		UploadedBy:    "uploader-us",
+		Timestamp:     time.Date(2024, 2, 28, 8, 30, 0, 0, time.UTC),
+		Extra:         map[string]interface{}{"region": "us", "pruned": true},
+	},
+	{
+		FileName:      "snapshot-251000000-AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96.json",
+		SolanaVersion: "1.17.31",
+		Slot:          251000000,
+		Status:        "failed",
+		Node:          "AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96",
+		UploadedBy:    "uploader-eu",
+		Timestamp:     time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+func TestQueryMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: "", want: []int64{250000100, 249000000, 251000000}},
+		{query: "status:ok", want: []int64{250000100}},
+		{query: "STATUS:OK", want: []int64{250000100}},
+		{query: "slot:>=250000000", want: []int64{250000100, 251000000}},
+		{query: "slot:<250000000", want: []int64{249000000}},
+		{query: "version:1.18.*", want: []int64{250000100, 249000000}},
+		{query: "version:>1.18.9", want: []int64{249000000}},
+		{query: "version:<=1.18.9", want: []int64{250000100, 251000000}},
+		{query: "status:(ok OR verified)", want: []int64{250000100, 249000000}},
+		{query: "status:(NOT failed)", want: []int64{250000100, 249000000}},
+		{query: "-node:AutUwEtGwA2wXfH4VqvpoY87d6vQzLkG1V6EugKx8t96", want: []int64{249000000}},
+		{query: "NOT status:failed AND uploaded_by:uploader-eu", want: []int64{250000100}},
+		{query: "status:failed OR status:verified slot:>250000000", want: []int64{251000000}},
+		{query: "(status:failed OR status:verified) slot:<250000000", want: []int64{249000000}},
+		{query: `uploader:"uploader-us"`, want: []int64{249000000}},
+		{query: `"uploader-eu"`, want: []int64{250000100, 251000000}},
+		{query: "betc1", want: []int64{249000000}},
+		{query: "feature_set:3469865029", want: []int64{250000100}},
+		{query: "timestamp:2024-03-01", want: []int64{250000100}},
+		{query: "timestamp:>2024-03-01", want: []int64{251000000}},
+		{query: "timestamp:>=2024-03-01T12:00:00Z", want: []int64{250000100, 251000000}},
+		{query: "extra.region:eu", want: []int64{250000100}},
+		{query: "extra.pruned:true", want: []int64{249000000}},
+		{query: "-extra.region:eu", want: []int64{249000000, 251000000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.query, err)
+			}
+
+			var got []int64
+			for _, metadata := range testMetadata {
+				if q.Match(metadata) {
+					got = append(got, metadata.Slot)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse(%q) matched %v, want %v", tt.query, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Parse(%q) matched %v, want %v", tt.query, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantPos int
+	}{
+		{query: "colour:red", wantPos: 0},
+		{query: "status:ok AND slot:abc", wantPos: 19},
+		{query: "status:(ok OR", wantPos: 13},
+		{query: "(status:ok", wantPos: 0},
+		{query: "status:ok)", wantPos: 9},
+		{query: `node:"unterminated`, wantPos: 5},
+		{query: "status: ok", wantPos: 7},
+		{query: "version:>1.18.*", wantPos: 9},
+		{query: "timestamp:yesterday", wantPos: 10},
+		{query: "OR status:ok", wantPos: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			var queryErr *Error
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("Parse(%q) error = %v, want a query error", tt.query, err)
+			}
+			if queryErr.Pos != tt.wantPos {
+				t.Errorf("Parse(%q) error position = %d, want %d (%v)", tt.query, queryErr.Pos, tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestQueryString(t *testing.T) {
+	q, err := Parse(`status:(ok OR verified) -node:abc slot:>=5`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := `(((status:"ok" OR status:"verified") AND NOT node:"abc") AND slot:>="5")`
+	if got := q.String(); got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
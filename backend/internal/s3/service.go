@@ -2,20 +2,46 @@ package s3
 
 import (
 	"context"
-	"strings"
+	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/blockdaemon/s3-bucket-browser/internal/config"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
 )
 
+const (
+	// defaultListPageSize is the number of keys requested per ListObjectsV2 call
+	defaultListPageSize = 1000
+)
+
+// Service implements storage.ObjectStore and storage.Presigner
+var (
+	_ storage.ObjectStore = (*Service)(nil)
+	_ storage.Presigner   = (*Service)(nil)
+)
+
+// client is the subset of the S3 API used by the service
+type client interface {
+	s3.ListObjectsV2APIClient
+	s3.HeadObjectAPIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
 // Service represents the S3 service
 type Service struct {
-	client *s3.Client
-	bucket string
+	client     client
+	presigner  *s3.PresignClient
+	bucket     string
+	pageSize   int32
+	maxObjects int
 }
 
 // NewService creates a new S3 service
@@ -29,9 +55,17 @@ func NewService(cfg *config.S3Config) (*Service, error) {
 	// Create S3 client
 	client := s3.NewFromConfig(awsCfg)
 
+	pageSize := cfg.ListPageSize
+	if pageSize <= 0 || pageSize > defaultListPageSize {
+		pageSize = defaultListPageSize
+	}
+
 	return &Service{
-		client: client,
-		bucket: cfg.Bucket,
+		client:     client,
+		presigner:  s3.NewPresignClient(client),
+		bucket:     cfg.Bucket,
+		pageSize:   pageSize,
+		maxObjects: cfg.MaxListObjects,
 	}, nil
 }
 
@@ -64,65 +98,198 @@ func createAWSConfig(cfg *config.S3Config) (aws.Config, error) {
 	return awsconfig.LoadDefaultConfig(context.Background(), options...)
 }
 
-// ListObjects lists objects in the S3 bucket
-func (s *Service) ListObjects(ctx context.Context, prefix string) ([]Object, error) {
+// ListObjects lists all objects in the S3 bucket under the given prefix,
+// following continuation tokens until the listing is complete or the
+// configured object cap is reached. If a page fails after earlier pages
+// succeeded or the cap is reached, the objects read so far are returned with
+// a *PartialListError.
+func (s *Service) ListObjects(ctx context.Context, prefix string) ([]storage.Object, error) {
+	var objects []storage.Object
+	err := s.WalkObjects(ctx, prefix, func(obj storage.Object) error {
+		objects = append(objects, obj)
+		return nil
+	})
+	if objects == nil {
+		objects = []storage.Object{}
+	}
+
+	return objects, err
+}
+
+// WalkObjects streams every object under the given prefix to fn, one page at
+// a time. Returning storage.ErrStopWalk from fn stops the walk without an error; any
+// other error stops the walk and is returned as is. Reaching the object cap
+// returns a *PartialListError wrapping storage.ErrListTruncated.
+func (s *Service) WalkObjects(ctx context.Context, prefix string, fn func(storage.Object) error) error {
 	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(prefix),
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(s.pageSize),
 	}
 
-	result, err := s.client.ListObjectsV2(ctx, input)
-	if err != nil {
-		return nil, err
+	paginator := s3.NewListObjectsV2Paginator(s.client, input, func(o *s3.ListObjectsV2PaginatorOptions) {
+		o.StopOnDuplicateToken = true
+	})
+
+	pages := 0
+	count := 0
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(ctx)
+		if err != nil {
+			if pages == 0 {
+				return err
+			}
+			return &storage.PartialListError{Pages: pages, Objects: count, Err: err}
+		}
+		pages++
+
+		for _, obj := range result.Contents {
+			if s.maxObjects > 0 && count >= s.maxObjects {
+				log.Printf("Listing of prefix %q stopped at the configured cap of %d objects", prefix, s.maxObjects)
+				return &storage.PartialListError{Pages: pages, Objects: count, Err: storage.ErrListTruncated}
+			}
+
+			if err := fn(newObject(obj)); err != nil {
+				if errors.Is(err, storage.ErrStopWalk) {
+					return nil
+				}
+				return err
+			}
+			count++
+		}
+	}
+
+	return nil
+}
+
+// ListDirectory lists a single folder-style level of the bucket below prefix,
+// returning the immediate sub-prefixes and the objects stored directly at
+// that level. Reaching the object cap returns the objects listed so far with
+// a *PartialListError wrapping storage.ErrListTruncated.
+func (s *Service) ListDirectory(ctx context.Context, prefix string) (*storage.Directory, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String(storage.Delimiter),
+		MaxKeys:   aws.Int32(s.pageSize),
 	}
 
-	objects := make([]Object, 0, len(result.Contents))
-	for _, obj := range result.Contents {
-		size := int64(0)
-		if obj.Size != nil {
-			size = *obj.Size
+	paginator := s3.NewListObjectsV2Paginator(s.client, input, func(o *s3.ListObjectsV2PaginatorOptions) {
+		o.StopOnDuplicateToken = true
+	})
+
+	dir := &storage.Directory{
+		Prefix:   prefix,
+		Prefixes: []string{},
+		Objects:  []storage.Object{},
+	}
+
+	pages := 0
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(ctx)
+		if err != nil {
+			if pages == 0 {
+				return nil, err
+			}
+			return dir, &storage.PartialListError{Pages: pages, Objects: len(dir.Objects), Err: err}
+		}
+		pages++
+
+		for _, commonPrefix := range result.CommonPrefixes {
+			dir.Prefixes = append(dir.Prefixes, aws.ToString(commonPrefix.Prefix))
 		}
 
-		objects = append(objects, Object{
-			Key:          *obj.Key,
-			Size:         size,
-			LastModified: *obj.LastModified,
-			ETag:         *obj.ETag,
-			IsTarGz:      IsTarGzFile(*obj.Key),
-			IsMetadata:   strings.HasSuffix(*obj.Key, ".json"),
-		})
+		for _, obj := range result.Contents {
+			if s.maxObjects > 0 && len(dir.Objects) >= s.maxObjects {
+				log.Printf("Listing of prefix %q stopped at the configured cap of %d objects", prefix, s.maxObjects)
+				return dir, &storage.PartialListError{Pages: pages, Objects: len(dir.Objects), Err: storage.ErrListTruncated}
+			}
+			dir.Objects = append(dir.Objects, newObject(obj))
+		}
 	}
 
-	return objects, nil
+	return dir, nil
+}
+
+// newObject converts an SDK object into a storage.Object
+func newObject(obj types.Object) storage.Object {
+	return storage.NewObject(
+		aws.ToString(obj.Key),
+		aws.ToInt64(obj.Size),
+		aws.ToTime(obj.LastModified),
+		aws.ToString(obj.ETag),
+	)
 }
 
 // GetObject gets an object from the S3 bucket
-func (s *Service) GetObject(ctx context.Context, key string) (*s3.GetObjectOutput, error) {
+func (s *Service) GetObject(ctx context.Context, key string) (*storage.ObjectReader, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
-	return s.client.GetObject(ctx, input)
+	result, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &storage.ObjectReader{
+		Body:          result.Body,
+		ContentType:   aws.ToString(result.ContentType),
+		ContentLength: aws.ToInt64(result.ContentLength),
+		ETag:          aws.ToString(result.ETag),
+		LastModified:  aws.ToTime(result.LastModified),
+	}, nil
 }
 
-// IsTarGzFile checks if a file is a .tar.gz file
-func IsTarGzFile(key string) bool {
-	return strings.HasSuffix(key, ".tar.gz")
+// HeadObject gets an object's attributes from the S3 bucket
+func (s *Service) HeadObject(ctx context.Context, key string) (*storage.Object, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+
+	result, err := s.client.HeadObject(ctx, input)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	obj := storage.NewObject(key, aws.ToInt64(result.ContentLength), aws.ToTime(result.LastModified), aws.ToString(result.ETag))
+	return &obj, nil
 }
 
-// GetMetadataFileKey returns the metadata file key for a .tar.gz file
-func GetMetadataFileKey(tarGzKey string) string {
-	// Remove .tar.gz extension and add .json
-	return strings.TrimSuffix(tarGzKey, ".tar.gz") + ".json"
+// translateError maps S3 "not found" errors to storage.ErrNotFound
+func translateError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return fmt.Errorf("%w: %v", storage.ErrNotFound, err)
+		}
+	}
+	return err
 }
 
-// Object represents an S3 object
-type Object struct {
-	Key          string
-	Size         int64
-	LastModified time.Time
-	ETag         string
-	IsMetadata   bool
-	IsTarGz      bool
+// PresignGetObject returns a presigned GET URL for an object that is valid for
+// the given duration. If filename is set, downloads are served with a
+// Content-Disposition header using that name.
+func (s *Service) PresignGetObject(ctx context.Context, key string, expiry time.Duration, filename string) (*storage.PresignedURL, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+
+	if filename != "" {
+		input.ResponseContentDisposition = aws.String(fmt.Sprintf("attachment; filename=%q", filename))
+	}
+
+	request, err := s.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage.PresignedURL{
+		URL:       request.URL,
+		ExpiresAt: time.Now().Add(expiry),
+	}, nil
 }
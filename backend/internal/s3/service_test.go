@@ -0,0 +1,221 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/blockdaemon/s3-bucket-browser/internal/storage"
+)
+
+// fakeClient serves a fixed set of keys in pages of the requested size
+type fakeClient struct {
+	keys   []string
+	failAt int // page number (1-based) that returns an error, 0 = never
+	calls  int
+}
+
+func (f *fakeClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.calls++
+	if f.failAt > 0 && f.calls == f.failAt {
+		return nil, errors.New("boom")
+	}
+
+	keys := make([]string, 0, len(f.keys))
+	for _, key := range f.keys {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+
+	start := 0
+	if params.ContinuationToken != nil {
+		fmt.Sscanf(*params.ContinuationToken, "%d", &start)
+	}
+	end := start + int(aws.ToInt32(params.MaxKeys))
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	output := &s3.ListObjectsV2Output{}
+	seen := make(map[string]bool)
+	for _, key := range keys[start:end] {
+		if delimiter := aws.ToString(params.Delimiter); delimiter != "" {
+			rest := strings.TrimPrefix(key, aws.ToString(params.Prefix))
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				commonPrefix := aws.ToString(params.Prefix) + rest[:i+1]
+				if !seen[commonPrefix] {
+					seen[commonPrefix] = true
+					output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+				}
+				continue
+			}
+		}
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(1),
+			LastModified: aws.Time(time.Unix(0, 0)),
+			ETag:         aws.String(`"etag"`),
+		})
+	}
+	if end < len(keys) {
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String(fmt.Sprintf("%d", end))
+	}
+
+	return output, nil
+}
+
+func (f *fakeClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, errors.New("not implemented")
+}
+
+func makeKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("snapshot-%d-node.json", i)
+	}
+	return keys
+}
+
+func TestListObjectsPagination(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       int
+		pageSize   int32
+		maxObjects int
+		failAt     int
+		wantCount  int
+		wantCalls  int
+		wantErr    bool
+		wantPart   bool
+		wantTrunc  bool
+	}{
+		{
+			name:      "single page",
+			keys:      5,
+			pageSize:  10,
+			wantCount: 5,
+			wantCalls: 1,
+		},
+		{
+			name:      "follows continuation tokens",
+			keys:      25,
+			pageSize:  10,
+			wantCount: 25,
+			wantCalls: 3,
+		},
+		{
+			name:       "stops at the object cap",
+			keys:       25,
+			pageSize:   10,
+			maxObjects: 12,
+			wantCount:  12,
+			wantCalls:  2,
+			wantErr:    true,
+			wantPart:   true,
+			wantTrunc:  true,
+		},
+		{
+			name:      "first page failure",
+			keys:      25,
+			pageSize:  10,
+			failAt:    1,
+			wantCount: 0,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "partial listing failure",
+			keys:      25,
+			pageSize:  10,
+			failAt:    2,
+			wantCount: 10,
+			wantCalls: 2,
+			wantErr:   true,
+			wantPart:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeClient{keys: makeKeys(tt.keys), failAt: tt.failAt}
+			service := &Service{client: fake, bucket: "bucket", pageSize: tt.pageSize, maxObjects: tt.maxObjects}
+
+			objects, err := service.ListObjects(context.Background(), "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListObjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var partialErr *storage.PartialListError
+			if got := errors.As(err, &partialErr); got != tt.wantPart {
+				t.Errorf("ListObjects() partial = %v, want %v", got, tt.wantPart)
+			}
+			if got := errors.Is(err, storage.ErrListTruncated); got != tt.wantTrunc {
+				t.Errorf("ListObjects() truncated = %v, want %v", got, tt.wantTrunc)
+			}
+			if len(objects) != tt.wantCount {
+				t.Errorf("ListObjects() returned %d objects, want %d", len(objects), tt.wantCount)
+			}
+			if fake.calls != tt.wantCalls {
+				t.Errorf("ListObjects() made %d calls, want %d", fake.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWalkObjectsStop(t *testing.T) {
+	fake := &fakeClient{keys: makeKeys(25)}
+	service := &Service{client: fake, bucket: "bucket", pageSize: 10}
+
+	seen := 0
+	err := service.WalkObjects(context.Background(), "", func(obj storage.Object) error {
+		seen++
+		if seen == 3 {
+			return storage.ErrStopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkObjects() error = %v", err)
+	}
+	if seen != 3 {
+		t.Errorf("WalkObjects() visited %d objects, want 3", seen)
+	}
+	if fake.calls != 1 {
+		t.Errorf("WalkObjects() made %d calls, want 1", fake.calls)
+	}
+}
+
+func TestListDirectory(t *testing.T) {
+	fake := &fakeClient{keys: []string{
+		"mainnet/node-a/snapshot-1-a.json",
+		"mainnet/node-a/snapshot-2-a.json",
+		"mainnet/node-b/snapshot-1-b.json",
+		"mainnet/readme.txt",
+		"testnet/node-c/snapshot-1-c.json",
+	}}
+	service := &Service{client: fake, bucket: "bucket", pageSize: 2}
+
+	dir, err := service.ListDirectory(context.Background(), "mainnet/")
+	if err != nil {
+		t.Fatalf("ListDirectory() error = %v", err)
+	}
+
+	wantPrefixes := []string{"mainnet/node-a/", "mainnet/node-b/"}
+	if strings.Join(dir.Prefixes, ",") != strings.Join(wantPrefixes, ",") {
+		t.Errorf("ListDirectory() prefixes = %v, want %v", dir.Prefixes, wantPrefixes)
+	}
+	if len(dir.Objects) != 1 || dir.Objects[0].Key != "mainnet/readme.txt" {
+		t.Errorf("ListDirectory() objects = %v, want [mainnet/readme.txt]", dir.Objects)
+	}
+}
@@ -0,0 +1,382 @@
+// Package schema validates metadata files against a JSON Schema. It supports
+// the keywords metadata files are described with: type, required,
+// properties, additionalProperties, items, enum, pattern, minLength,
+// maxLength, minimum and maximum. Other keywords are ignored.
+package schema
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed default.json
+var defaultSchema []byte
+
+// Problem classes
+const (
+	// ClassParseError is a file that is not a JSON object
+	ClassParseError = "parse_error"
+	// ClassMissingField is a required field that is missing
+	ClassMissingField = "missing_field"
+	// ClassTypeMismatch is a value of the wrong type
+	ClassTypeMismatch = "type_mismatch"
+	// ClassInvalidValue is a value of the right type that is not allowed
+	ClassInvalidValue = "invalid_value"
+	// ClassUnknownField is a field the schema does not allow
+	ClassUnknownField = "unknown_field"
+)
+
+// Problem is a way in which a file does not conform to the schema
+type Problem struct {
+	Class string `json:"class"`
+	// Field is the path of the offending value, as in build.commit, or
+	// empty for the whole file
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	root        *node
+	fingerprint string
+}
+
+// node is a compiled schema or subschema
+type node struct {
+	Types                []string         `json:"-"`
+	Required             []string         `json:"required"`
+	Properties           map[string]*node `json:"properties"`
+	AdditionalProperties *node            `json:"-"`
+	NoAdditional         bool             `json:"-"`
+	Items                *node            `json:"items"`
+	Enum                 []interface{}    `json:"enum"`
+	Pattern              string           `json:"pattern"`
+	MinLength            *int             `json:"minLength"`
+	MaxLength            *int             `json:"maxLength"`
+	Minimum              *float64         `json:"minimum"`
+	Maximum              *float64         `json:"maximum"`
+	pattern              *regexp.Regexp
+}
+
+// validTypes are the values of the type keyword
+var validTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// UnmarshalJSON decodes the keywords whose values can take several forms
+func (n *node) UnmarshalJSON(data []byte) error {
+	type keywords node
+	if err := json.Unmarshal(data, (*keywords)(n)); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Type                 json.RawMessage `json:"type"`
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if len(raw.Type) > 0 {
+		var single string
+		if err := json.Unmarshal(raw.Type, &single); err == nil {
+			n.Types = []string{single}
+		} else if err := json.Unmarshal(raw.Type, &n.Types); err != nil {
+			return fmt.Errorf("type must be a string or a list of strings")
+		}
+		for _, t := range n.Types {
+			if !validTypes[t] {
+				return fmt.Errorf("unknown type %q", t)
+			}
+		}
+	}
+
+	if len(raw.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(raw.AdditionalProperties, &allowed); err == nil {
+			n.NoAdditional = !allowed
+		} else if err := json.Unmarshal(raw.AdditionalProperties, &n.AdditionalProperties); err != nil {
+			return fmt.Errorf("additionalProperties must be a boolean or a schema: %w", err)
+		}
+	}
+
+	if n.Pattern != "" {
+		pattern, err := regexp.Compile(n.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", n.Pattern, err)
+		}
+		n.pattern = pattern
+	}
+
+	return nil
+}
+
+// Parse compiles a JSON Schema
+func Parse(data []byte) (*Schema, error) {
+	var root node
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return &Schema{root: &root, fingerprint: hex.EncodeToString(sum[:8])}, nil
+}
+
+// Load compiles the JSON Schema in a file, or the default schema if path is
+// empty
+func Load(path string) (*Schema, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	schema, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// MustLoad is like Load but panics if the schema is invalid
+func MustLoad(path string) *Schema {
+	schema, err := Load(path)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// Default returns the schema of Solana snapshot metadata files
+func Default() *Schema {
+	schema, err := Parse(defaultSchema)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// Fingerprint identifies the schema, so that files can be validated again
+// when it changes
+func (s *Schema) Fingerprint() string {
+	return s.fingerprint
+}
+
+// Validate checks a file against the schema. Problems are ordered by field.
+func (s *Schema) Validate(data []byte) []Problem {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []Problem{{Class: ClassParseError, Message: err.Error()}}
+	}
+	if decoder.More() {
+		return []Problem{{Class: ClassParseError, Message: "unexpected data after the JSON value"}}
+	}
+
+	var problems []Problem
+	s.root.validate("", value, &problems)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Field < problems[j].Field })
+	return problems
+}
+
+// validate checks a value against a node and appends its problems
+func (n *node) validate(path string, value interface{}, problems *[]Problem) {
+	if len(n.Types) > 0 && !hasType(value, n.Types) {
+		*problems = append(*problems, Problem{
+			Class:   ClassTypeMismatch,
+			Field:   path,
+			Message: fmt.Sprintf("expected %s, got %s", strings.Join(n.Types, " or "), typeOf(value)),
+		})
+		return
+	}
+
+	if len(n.Enum) > 0 && !inEnum(value, n.Enum) {
+		*problems = append(*problems, Problem{
+			Class:   ClassInvalidValue,
+			Field:   path,
+			Message: fmt.Sprintf("%s is not one of the allowed values", describe(value)),
+		})
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		n.validateObject(path, v, problems)
+	case []interface{}:
+		if n.Items != nil {
+			for i, item := range v {
+				n.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case string:
+		n.validateString(path, v, problems)
+	case json.Number:
+		n.validateNumber(path, v, problems)
+	}
+}
+
+// validateObject checks the fields of an object
+func (n *node) validateObject(path string, object map[string]interface{}, problems *[]Problem) {
+	for _, field := range n.Required {
+		if _, ok := object[field]; !ok {
+			*problems = append(*problems, Problem{
+				Class:   ClassMissingField,
+				Field:   joinPath(path, field),
+				Message: "required field is missing",
+			})
+		}
+	}
+
+	fields := make([]string, 0, len(object))
+	for field := range object {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value := object[field]
+		if property, ok := n.Properties[field]; ok {
+			property.validate(joinPath(path, field), value, problems)
+			continue
+		}
+		switch {
+		case n.NoAdditional:
+			*problems = append(*problems, Problem{
+				Class:   ClassUnknownField,
+				Field:   joinPath(path, field),
+				Message: "field is not allowed",
+			})
+		case n.AdditionalProperties != nil:
+			n.AdditionalProperties.validate(joinPath(path, field), value, problems)
+		}
+	}
+}
+
+// validateString checks the length and pattern of a string
+func (n *node) validateString(path, value string, problems *[]Problem) {
+	length := utf8.RuneCountInString(value)
+	if n.MinLength != nil && length < *n.MinLength {
+		*problems = append(*problems, Problem{
+			Class:   ClassInvalidValue,
+			Field:   path,
+			Message: fmt.Sprintf("must be at least %d characters long", *n.MinLength),
+		})
+	}
+	if n.MaxLength != nil && length > *n.MaxLength {
+		*problems = append(*problems, Problem{
+			Class:   ClassInvalidValue,
+			Field:   path,
+			Message: fmt.Sprintf("must be at most %d characters long", *n.MaxLength),
+		})
+	}
+	if n.pattern != nil && !n.pattern.MatchString(value) {
+		*problems = append(*problems, Problem{
+			Class:   ClassInvalidValue,
+			Field:   path,
+			Message: fmt.Sprintf("%q does not match %s", value, n.Pattern),
+		})
+	}
+}
+
+// validateNumber checks the bounds of a number
+func (n *node) validateNumber(path string, value json.Number, problems *[]Problem) {
+	number, err := value.Float64()
+	if err != nil {
+		return
+	}
+	if n.Minimum != nil && number < *n.Minimum {
+		*problems = append(*problems, Problem{
+			Class:   ClassInvalidValue,
+			Field:   path,
+			Message: fmt.Sprintf("%s is less than the minimum of %v", value, *n.Minimum),
+		})
+	}
+	if n.Maximum != nil && number > *n.Maximum {
+		*problems = append(*problems, Problem{
+			Class:   ClassInvalidValue,
+			Field:   path,
+			Message: fmt.Sprintf("%s is greater than the maximum of %v", value, *n.Maximum),
+		})
+	}
+}
+
+// hasType reports whether a value has any of the given types
+func hasType(value interface{}, types []string) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of a decoded value. Numbers without a
+// fractional part are integers.
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := v.Float64(); err == nil && f == float64(int64(f)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// inEnum reports whether a value is one of the allowed values
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if describe(allowed) == describe(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns the JSON form of a value
+func describe(value interface{}) string {
+	if number, ok := value.(json.Number); ok {
+		if f, err := number.Float64(); err == nil {
+			value = f
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// joinPath appends a field to a path
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateDefault(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Problem
+	}{
+		{
+			name: "valid",
+			body: `{"solana_version":"1.18.1","solana_feature_set":3469865029,"status":"ok","uploaded_by":"node-a","slot":"100","region":"eu"}`,
+		},
+		{
+			name: "missing fields",
+			body: `{"solana_version":"1.18.1","status":"ok"}`,
+			want: []Problem{
+				{Class: ClassMissingField, Field: "solana_feature_set", Message: "required field is missing"},
+				{Class: ClassMissingField, Field: "uploaded_by", Message: "required field is missing"},
+			},
+		},
+		{
+			name: "type mismatches and invalid values",
+			body: `{"solana_version":1.18,"solana_feature_set":"abc","status":"ok","uploaded_by":"","slot":1.5,"snapshot_type":"partial"}`,
+			want: []Problem{
+				{Class: ClassTypeMismatch, Field: "slot", Message: "expected integer or string, got number"},
+				{Class: ClassInvalidValue, Field: "snapshot_type", Message: `"partial" is not one of the allowed values`},
+				{Class: ClassInvalidValue, Field: "solana_feature_set", Message: `"abc" does not match ^[0-9]+$`},
+				{Class: ClassTypeMismatch, Field: "solana_version", Message: "expected string, got number"},
+				{Class: ClassInvalidValue, Field: "uploaded_by", Message: "must be at least 1 characters long"},
+			},
+		},
+		{
+			name: "not an object",
+			body: `[1, 2]`,
+			want: []Problem{{Class: ClassTypeMismatch, Message: "expected object, got array"}},
+		},
+		{
+			name: "not JSON",
+			body: `{"solana_version":`,
+			want: []Problem{{Class: ClassParseError, Message: "unexpected EOF"}},
+		},
+	}
+
+	schema := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schema.Validate([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNested(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"type": "object",
+		"additionalProperties": false,
+		"properties": {
+			"build": {"type": "object", "required": ["commit"], "additionalProperties": {"type": "boolean"}},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"replicas": {"type": "integer", "minimum": 1, "maximum": 5}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got := schema.Validate([]byte(`{"build":{"dirty":"no"},"tags":["a",2],"replicas":7,"region":"eu"}`))
+	want := []Problem{
+		{Class: ClassMissingField, Field: "build.commit", Message: "required field is missing"},
+		{Class: ClassTypeMismatch, Field: "build.dirty", Message: "expected boolean, got string"},
+		{Class: ClassUnknownField, Field: "region", Message: "field is not allowed"},
+		{Class: ClassInvalidValue, Field: "replicas", Message: "7 is greater than the maximum of 5"},
+		{Class: ClassTypeMismatch, Field: "tags[1]", Message: "expected string, got integer"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(valid, []byte(`{"type":"object","required":["slot"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"type":"text"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := Load(valid)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if schema.Fingerprint() == Default().Fingerprint() {
+		t.Errorf("Load() fingerprint equals the default schema's")
+	}
+
+	for _, path := range []string{invalid, filepath.Join(dir, "missing.json")} {
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) error = nil, want an error", path)
+		}
+	}
+}
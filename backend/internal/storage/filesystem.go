@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileSystemStore is an ObjectStore backed by a local directory. Object keys
+// are paths relative to the root, always using "/" as separator.
+type FileSystemStore struct {
+	root string
+}
+
+// NewFileSystemStore creates a store rooted at the given directory
+func NewFileSystemStore(root string) (*FileSystemStore, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", abs)
+	}
+
+	return &FileSystemStore{root: abs}, nil
+}
+
+// ListObjects lists all objects under the given prefix
+func (f *FileSystemStore) ListObjects(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	err := f.WalkObjects(ctx, prefix, func(obj Object) error {
+		objects = append(objects, obj)
+		return nil
+	})
+
+	return objects, err
+}
+
+// WalkObjects streams every object under the given prefix to fn in key order
+func (f *FileSystemStore) WalkObjects(ctx context.Context, prefix string, fn func(Object) error) error {
+	// filepath.WalkDir visits entries in lexical order, but "a/b" must sort
+	// after "a-b" like it does in S3, so collect and sort the keys first
+	var objects []Object
+	err := filepath.WalkDir(f.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		key := f.keyFor(p)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, objectFromFileInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return walkSorted(objects, fn)
+}
+
+// ListDirectory lists a single folder-style level below prefix
+func (f *FileSystemStore) ListDirectory(ctx context.Context, prefix string) (*Directory, error) {
+	objects, err := f.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildDirectory(prefix, objects), nil
+}
+
+// GetObject opens an object for reading
+func (f *FileSystemStore) GetObject(ctx context.Context, key string) (*ObjectReader, error) {
+	p, err := f.pathFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+
+	obj := objectFromFileInfo(key, info)
+	return &ObjectReader{
+		Body:          file,
+		ContentType:   contentTypeForKey(key),
+		ContentLength: obj.Size,
+		ETag:          obj.ETag,
+		LastModified:  obj.LastModified,
+	}, nil
+}
+
+// HeadObject returns an object's attributes without its content
+func (f *FileSystemStore) HeadObject(ctx context.Context, key string) (*Object, error) {
+	p, err := f.pathFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	obj := objectFromFileInfo(key, info)
+	return &obj, nil
+}
+
+// PutObject writes an object, creating parent directories as needed. The file
+// is written to a temporary name first so readers never see partial content.
+func (f *FileSystemStore) PutObject(ctx context.Context, key string, body io.Reader) error {
+	p, err := f.pathFor(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+// DeleteObject removes an object. Deleting a missing object is not an error.
+func (f *FileSystemStore) DeleteObject(ctx context.Context, key string) error {
+	p, err := f.pathFor(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// keyFor converts a path below the root into an object key
+func (f *FileSystemStore) keyFor(p string) string {
+	rel, _ := filepath.Rel(f.root, p)
+	return filepath.ToSlash(rel)
+}
+
+// pathFor converts an object key into a path, refusing keys that would
+// escape the root
+func (f *FileSystemStore) pathFor(key string) (string, error) {
+	if key == "" {
+		return "", ErrNotFound
+	}
+
+	p := filepath.Join(f.root, filepath.FromSlash(key))
+	if p != f.root && !strings.HasPrefix(p, f.root+string(filepath.Separator)) {
+		return "", fmt.Errorf("key %q is outside the store root", key)
+	}
+
+	return p, nil
+}
+
+// objectFromFileInfo builds an Object from file attributes. The ETag is
+// derived from size and modification time so it changes whenever the file
+// does, without having to hash the content.
+func objectFromFileInfo(key string, info fs.FileInfo) Object {
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	return NewObject(key, info.Size(), info.ModTime().UTC(), etag)
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryObject is an object held by the memory store
+type memoryObject struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// MemoryStore is an ObjectStore that keeps all objects in memory. It is
+// mainly useful for tests and demos.
+type MemoryStore struct {
+	objects map[string]*memoryObject
+	mutex   sync.RWMutex
+}
+
+// NewMemoryStore creates a new, empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]*memoryObject),
+	}
+}
+
+// ListObjects lists all objects under the given prefix
+func (m *MemoryStore) ListObjects(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	err := m.WalkObjects(ctx, prefix, func(obj Object) error {
+		objects = append(objects, obj)
+		return nil
+	})
+
+	return objects, err
+}
+
+// WalkObjects streams every object under the given prefix to fn in key order
+func (m *MemoryStore) WalkObjects(ctx context.Context, prefix string, fn func(Object) error) error {
+	return walkSorted(m.snapshot(prefix), fn)
+}
+
+// ListDirectory lists a single folder-style level below prefix
+func (m *MemoryStore) ListDirectory(ctx context.Context, prefix string) (*Directory, error) {
+	objects, err := m.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildDirectory(prefix, objects), nil
+}
+
+// GetObject opens an object for reading
+func (m *MemoryStore) GetObject(ctx context.Context, key string) (*ObjectReader, error) {
+	m.mutex.RLock()
+	obj, ok := m.objects[key]
+	m.mutex.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &ObjectReader{
+		Body:          io.NopCloser(bytes.NewReader(obj.data)),
+		ContentType:   contentTypeForKey(key),
+		ContentLength: int64(len(obj.data)),
+		ETag:          obj.etag,
+		LastModified:  obj.lastModified,
+	}, nil
+}
+
+// HeadObject returns an object's attributes without its content
+func (m *MemoryStore) HeadObject(ctx context.Context, key string) (*Object, error) {
+	m.mutex.RLock()
+	obj, ok := m.objects[key]
+	m.mutex.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := NewObject(key, int64(len(obj.data)), obj.lastModified, obj.etag)
+	return &result, nil
+}
+
+// PutObject stores an object, replacing any existing object with the same key
+func (m *MemoryStore) PutObject(ctx context.Context, key string, body io.Reader) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	sum := md5.Sum(data)
+
+	m.mutex.Lock()
+	m.objects[key] = &memoryObject{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		lastModified: time.Now().UTC(),
+	}
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// DeleteObject removes an object. Deleting a missing object is not an error.
+func (m *MemoryStore) DeleteObject(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	delete(m.objects, key)
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// snapshot copies the objects under prefix so they can be walked unlocked
+func (m *MemoryStore) snapshot(prefix string) []Object {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	objects := make([]Object, 0, len(m.objects))
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, NewObject(key, int64(len(obj.data)), obj.lastModified, obj.etag))
+		}
+	}
+
+	return objects
+}
+
+// contentTypeForKey guesses a content type from the key's extension
+func contentTypeForKey(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
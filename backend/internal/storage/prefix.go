@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// prefixStore exposes the objects below a prefix of another store as if they
+// were at its root
+type prefixStore struct {
+	store  ObjectStore
+	prefix string
+}
+
+// presigningPrefixStore is a prefixStore over a store that can presign URLs
+type presigningPrefixStore struct {
+	*prefixStore
+	presigner Presigner
+}
+
+// WithPrefix limits a store to the keys below prefix, with the prefix removed
+// from every key it returns. The result implements Presigner if store does.
+func WithPrefix(store ObjectStore, prefix string) ObjectStore {
+	if prefix == "" {
+		return store
+	}
+
+	prefixed := &prefixStore{store: store, prefix: prefix}
+	if presigner, ok := store.(Presigner); ok {
+		return &presigningPrefixStore{prefixStore: prefixed, presigner: presigner}
+	}
+
+	return prefixed
+}
+
+// ListObjects lists all objects under the given prefix
+func (p *prefixStore) ListObjects(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	err := p.WalkObjects(ctx, prefix, func(obj Object) error {
+		objects = append(objects, obj)
+		return nil
+	})
+
+	return objects, err
+}
+
+// WalkObjects streams every object under the given prefix to fn in key order
+func (p *prefixStore) WalkObjects(ctx context.Context, prefix string, fn func(Object) error) error {
+	return p.store.WalkObjects(ctx, p.prefix+prefix, func(obj Object) error {
+		obj.Key = strings.TrimPrefix(obj.Key, p.prefix)
+		return fn(obj)
+	})
+}
+
+// ListDirectory lists a single folder-style level below prefix
+func (p *prefixStore) ListDirectory(ctx context.Context, prefix string) (*Directory, error) {
+	dir, err := p.store.ListDirectory(ctx, p.prefix+prefix)
+	if dir == nil {
+		return nil, err
+	}
+
+	dir.Prefix = strings.TrimPrefix(dir.Prefix, p.prefix)
+	for i := range dir.Prefixes {
+		dir.Prefixes[i] = strings.TrimPrefix(dir.Prefixes[i], p.prefix)
+	}
+	for i := range dir.Objects {
+		dir.Objects[i].Key = strings.TrimPrefix(dir.Objects[i].Key, p.prefix)
+	}
+
+	return dir, err
+}
+
+// GetObject opens an object for reading
+func (p *prefixStore) GetObject(ctx context.Context, key string) (*ObjectReader, error) {
+	return p.store.GetObject(ctx, p.prefix+key)
+}
+
+// HeadObject returns an object's attributes without its content
+func (p *prefixStore) HeadObject(ctx context.Context, key string) (*Object, error) {
+	obj, err := p.store.HeadObject(ctx, p.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+
+	obj.Key = key
+	return obj, nil
+}
+
+// PresignGetObject returns a presigned GET URL for an object below the prefix
+func (p *presigningPrefixStore) PresignGetObject(ctx context.Context, key string, expiry time.Duration, filename string) (*PresignedURL, error) {
+	return p.presigner.PresignGetObject(ctx, p.prefix+key, expiry, filename)
+}
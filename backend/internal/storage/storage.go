@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Delimiter separates folder-style levels in object keys
+const Delimiter = "/"
+
+var (
+	// ErrNotFound is returned when an object does not exist
+	ErrNotFound = errors.New("object not found")
+
+	// ErrNotSupported is returned when a backend does not support an operation
+	ErrNotSupported = errors.New("operation not supported by this backend")
+
+	// ErrStopWalk can be returned by a WalkObjects callback to stop the walk
+	// early without reporting an error
+	ErrStopWalk = errors.New("stop walk")
+
+	// ErrListTruncated is wrapped in a PartialListError when a listing stops
+	// at the configured object cap
+	ErrListTruncated = errors.New("listing truncated at the object cap")
+)
+
+// ObjectStore is the read interface every storage backend implements
+type ObjectStore interface {
+	// ListObjects lists all objects under the given prefix
+	ListObjects(ctx context.Context, prefix string) ([]Object, error)
+
+	// WalkObjects streams every object under the given prefix to fn in key
+	// order. Returning ErrStopWalk from fn stops the walk without an error.
+	WalkObjects(ctx context.Context, prefix string, fn func(Object) error) error
+
+	// ListDirectory lists a single folder-style level below prefix
+	ListDirectory(ctx context.Context, prefix string) (*Directory, error)
+
+	// GetObject opens an object for reading. The caller must close the body.
+	GetObject(ctx context.Context, key string) (*ObjectReader, error)
+
+	// HeadObject returns an object's attributes without its content
+	HeadObject(ctx context.Context, key string) (*Object, error)
+}
+
+// Presigner is implemented by backends that can hand out time-limited
+// download URLs
+type Presigner interface {
+	PresignGetObject(ctx context.Context, key string, expiry time.Duration, filename string) (*PresignedURL, error)
+}
+
+// Writer is implemented by backends that can store and remove objects
+type Writer interface {
+	PutObject(ctx context.Context, key string, body io.Reader) error
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// Object represents a stored object
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	IsMetadata   bool
+	// IsTarGz is set for archives of any compression; the name is kept for
+	// API compatibility
+	IsTarGz bool
+	// ArtifactType is the configured artifact type the key matches, if any
+	ArtifactType string `json:",omitempty"`
+}
+
+// NewObject creates an Object and classifies it by its key
+func NewObject(key string, size int64, lastModified time.Time, etag string) Object {
+	return Object{
+		Key:          key,
+		Size:         size,
+		LastModified: lastModified,
+		ETag:         etag,
+		IsTarGz:      IsArchiveFile(key),
+		IsMetadata:   strings.HasSuffix(key, ".json"),
+	}
+}
+
+// ObjectReader represents an object opened for reading
+type ObjectReader struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+	ETag          string
+	LastModified  time.Time
+}
+
+// Directory represents one folder-style level of the store
+type Directory struct {
+	Prefix   string
+	Prefixes []string
+	Objects  []Object
+}
+
+// PresignedURL represents a time-limited download URL for an object
+type PresignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PartialListError is returned when a listing fails after some pages have
+// already been read. The objects listed so far are still returned.
+type PartialListError struct {
+	Pages   int
+	Objects int
+	Err     error
+}
+
+// Error implements the error interface
+func (e *PartialListError) Error() string {
+	return fmt.Sprintf("listing failed after %d pages (%d objects): %v", e.Pages, e.Objects, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *PartialListError) Unwrap() error {
+	return e.Err
+}
+
+// ArchiveExtensions lists the snapshot archive formats, most specific first
+var ArchiveExtensions = []string{".tar.gz", ".tar.zst", ".tar.bz2", ".tar.lz4", ".tar"}
+
+// ArchiveExtension returns the archive extension of a key, or an empty
+// string if it is not an archive
+func ArchiveExtension(key string) string {
+	for _, ext := range ArchiveExtensions {
+		if strings.HasSuffix(key, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// IsArchiveFile checks if a file is a snapshot archive of any compression
+func IsArchiveFile(key string) bool {
+	return ArchiveExtension(key) != ""
+}
+
+// GetMetadataFileKey returns the metadata file key for an archive
+func GetMetadataFileKey(archiveKey string) string {
+	// Replace the archive extension with .json
+	return strings.TrimSuffix(archiveKey, ArchiveExtension(archiveKey)) + ".json"
+}
+
+// CopyObjects copies every object under prefix from src to dst
+func CopyObjects(ctx context.Context, dst Writer, src ObjectStore, prefix string) error {
+	return src.WalkObjects(ctx, prefix, func(obj Object) error {
+		reader, err := src.GetObject(ctx, obj.Key)
+		if err != nil {
+			return err
+		}
+		defer reader.Body.Close()
+
+		return dst.PutObject(ctx, obj.Key, reader.Body)
+	})
+}
+
+// walkSorted calls fn for every object in key order, honouring ErrStopWalk
+func walkSorted(objects []Object, fn func(Object) error) error {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	for _, obj := range objects {
+		if err := fn(obj); err != nil {
+			if errors.Is(err, ErrStopWalk) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildDirectory groups a flat, sorted listing under prefix into sub-prefixes
+// and objects, the way a delimited S3 listing would
+func buildDirectory(prefix string, objects []Object) *Directory {
+	dir := &Directory{
+		Prefix:   prefix,
+		Prefixes: []string{},
+		Objects:  []Object{},
+	}
+
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		rest := strings.TrimPrefix(obj.Key, prefix)
+		if i := strings.Index(rest, Delimiter); i >= 0 {
+			subPrefix := prefix + rest[:i+1]
+			if !seen[subPrefix] {
+				seen[subPrefix] = true
+				dir.Prefixes = append(dir.Prefixes, subPrefix)
+			}
+			continue
+		}
+		dir.Objects = append(dir.Objects, obj)
+	}
+
+	return dir
+}
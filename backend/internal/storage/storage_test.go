@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func seedStore(t *testing.T, store Writer, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := store.PutObject(context.Background(), key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatalf("PutObject(%q) error = %v", key, err)
+		}
+	}
+}
+
+func newStores(t *testing.T) map[string]interface {
+	ObjectStore
+	Writer
+} {
+	fsStore, err := NewFileSystemStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSystemStore() error = %v", err)
+	}
+
+	return map[string]interface {
+		ObjectStore
+		Writer
+	}{
+		"memory":     NewMemoryStore(),
+		"filesystem": fsStore,
+	}
+}
+
+func TestStoreListAndGet(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seedStore(t, store, "mainnet/a/snapshot-1-node.json", "mainnet/a/snapshot-1-node.tar.gz", "mainnet/b.json", "testnet/c.json")
+
+			objects, err := store.ListObjects(ctx, "mainnet/")
+			if err != nil {
+				t.Fatalf("ListObjects() error = %v", err)
+			}
+
+			var keys []string
+			for _, obj := range objects {
+				keys = append(keys, obj.Key)
+			}
+			want := []string{"mainnet/a/snapshot-1-node.json", "mainnet/a/snapshot-1-node.tar.gz", "mainnet/b.json"}
+			if !reflect.DeepEqual(keys, want) {
+				t.Errorf("ListObjects() keys = %v, want %v", keys, want)
+			}
+			if !objects[0].IsMetadata || !objects[1].IsTarGz {
+				t.Errorf("ListObjects() did not classify objects: %+v", objects[:2])
+			}
+
+			reader, err := store.GetObject(ctx, "mainnet/b.json")
+			if err != nil {
+				t.Fatalf("GetObject() error = %v", err)
+			}
+			defer reader.Body.Close()
+
+			data, _ := io.ReadAll(reader.Body)
+			if string(data) != "content of mainnet/b.json" || reader.ContentLength != int64(len(data)) {
+				t.Errorf("GetObject() = %q (length %d)", data, reader.ContentLength)
+			}
+
+			if _, err := store.GetObject(ctx, "missing.json"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetObject() missing error = %v, want ErrNotFound", err)
+			}
+			if _, err := store.HeadObject(ctx, "missing.json"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("HeadObject() missing error = %v, want ErrNotFound", err)
+			}
+
+			if err := store.DeleteObject(ctx, "mainnet/b.json"); err != nil {
+				t.Fatalf("DeleteObject() error = %v", err)
+			}
+			if _, err := store.HeadObject(ctx, "mainnet/b.json"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("HeadObject() after delete error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreListDirectory(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			seedStore(t, store, "mainnet/a/1.json", "mainnet/a/2.json", "mainnet/b/1.json", "mainnet/top.json", "root.json")
+
+			dir, err := store.ListDirectory(context.Background(), "mainnet/")
+			if err != nil {
+				t.Fatalf("ListDirectory() error = %v", err)
+			}
+
+			if want := []string{"mainnet/a/", "mainnet/b/"}; !reflect.DeepEqual(dir.Prefixes, want) {
+				t.Errorf("ListDirectory() prefixes = %v, want %v", dir.Prefixes, want)
+			}
+			if len(dir.Objects) != 1 || dir.Objects[0].Key != "mainnet/top.json" {
+				t.Errorf("ListDirectory() objects = %+v, want only mainnet/top.json", dir.Objects)
+			}
+		})
+	}
+}
+
+func TestFileSystemStoreRejectsEscapingKeys(t *testing.T) {
+	store, err := NewFileSystemStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSystemStore() error = %v", err)
+	}
+
+	if _, err := store.GetObject(context.Background(), "../etc/passwd"); err == nil {
+		t.Error("GetObject() with escaping key succeeded, want error")
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	seedStore(t, store, "mainnet/a/1.json", "mainnet/top.json", "mainnet-other.json", "testnet/1.json")
+
+	prefixed := WithPrefix(store, "mainnet/")
+
+	objects, err := prefixed.ListObjects(ctx, "")
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	var keys []string
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	if want := []string{"a/1.json", "top.json"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListObjects() keys = %v, want %v", keys, want)
+	}
+
+	dir, err := prefixed.ListDirectory(ctx, "")
+	if err != nil {
+		t.Fatalf("ListDirectory() error = %v", err)
+	}
+	if want := []string{"a/"}; !reflect.DeepEqual(dir.Prefixes, want) {
+		t.Errorf("ListDirectory() prefixes = %v, want %v", dir.Prefixes, want)
+	}
+
+	obj, err := prefixed.HeadObject(ctx, "top.json")
+	if err != nil || obj.Key != "top.json" {
+		t.Errorf("HeadObject() = %+v, %v", obj, err)
+	}
+
+	if _, ok := prefixed.(Presigner); ok {
+		t.Error("WithPrefix() over a memory store implements Presigner")
+	}
+}
+
+func TestGetMetadataFileKey(t *testing.T) {
+	tests := map[string]string{
+		"snapshot-1-node.tar.gz":                "snapshot-1-node.json",
+		"snapshot-1-node.tar.zst":               "snapshot-1-node.json",
+		"incremental-snapshot-1-2-node.tar.bz2": "incremental-snapshot-1-2-node.json",
+		"snapshot-1-node.tar":                   "snapshot-1-node.json",
+	}
+	for key, want := range tests {
+		if got := GetMetadataFileKey(key); got != want {
+			t.Errorf("GetMetadataFileKey(%q) = %q, want %q", key, got, want)
+		}
+		if !IsArchiveFile(key) {
+			t.Errorf("IsArchiveFile(%q) = false, want true", key)
+		}
+	}
+
+	if IsArchiveFile("snapshot-1-node.json") {
+		t.Errorf("IsArchiveFile() = true for a metadata file")
+	}
+}